@@ -5,13 +5,16 @@ import (
 	stdlog "log"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 	"github.com/sanjeevsethi/sre-platform-app/internal/api"
 	"github.com/sanjeevsethi/sre-platform-app/internal/config"
+	"github.com/sanjeevsethi/sre-platform-app/internal/diagnostics"
+	"github.com/sanjeevsethi/sre-platform-app/internal/health"
+	"github.com/sanjeevsethi/sre-platform-app/internal/lifecycle"
 	"github.com/sanjeevsethi/sre-platform-app/internal/logger"
 	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
 	"github.com/sanjeevsethi/sre-platform-app/internal/telemetry"
@@ -29,7 +32,16 @@ func main() {
 	// In production, we'd probably want this to be false (JSON logs)
 	// For dev, reading console logs is nicer.
 	// We could put this in config too: cfg.LogPretty
-	logger.Init("info", os.Getenv("GIN_MODE") != "release")
+	if _, err := logger.ParseLevel(cfg.LogLevel); err != nil {
+		stdlog.Fatalf("Invalid LOG_LEVEL: %v", err)
+	}
+	if cfg.LogLevelTTL <= 0 {
+		stdlog.Fatalf("Invalid LOG_LEVEL_TTL %s: must be positive", cfg.LogLevelTTL)
+	}
+	logger.Init(cfg.LogLevel, os.Getenv("GIN_MODE") != "release")
+
+	// Components stop in reverse order: the HTTP server first, the tracer last
+	group := lifecycle.New()
 
 	// 4. Initialize Tracing
 	shutdownTracer, err := telemetry.InitTracer("api-service")
@@ -38,70 +50,328 @@ func main() {
 		// We don't fatal here to allow running without collector in dev if needed,
 		// though strictly SRE practice says observability is critical.
 	} else {
-		defer func() {
-			if err := shutdownTracer(context.Background()); err != nil {
-				stdlog.Printf("Error shutting down tracer: %v", err)
-			}
-		}()
+		group.Add(lifecycle.Component{Name: "tracer", Stop: shutdownTracer})
+	}
+
+	// Admin listener for /debug/info and pprof. Added early so it stops late,
+	// and a stuck shutdown can still be profiled.
+	if cfg.AdminAddr != "" {
+		group.Add(lifecycle.HTTPServer("admin-server", &http.Server{Addr: cfg.AdminAddr, Handler: diagnostics.Handler()}, nil))
 	}
 
 	// 5. Initialize Queue Producer
-	producer := queue.NewProducer(cfg.RedisAddr)
-	defer producer.Close()
+	codec, err := queue.NewCodecFromConfig(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid payload codec configuration")
+	}
+	producerOpts := []queue.ProducerOption{queue.WithCodec(codec)}
+
+	// Optional local spool that accepts jobs while Redis is unavailable
+	if cfg.SpoolDir != "" {
+		if cfg.SpoolRelayInterval <= 0 {
+			log.Fatal().Dur("interval", cfg.SpoolRelayInterval).Msg("SPOOL_RELAY_INTERVAL must be positive")
+		}
+		spool, err := queue.OpenSpool(cfg.SpoolDir, cfg.SpoolMaxBytes, cfg.SpoolMaxEntries)
+		if err != nil {
+			log.Fatal().Err(err).Str("dir", cfg.SpoolDir).Msg("Failed to open job spool")
+		}
+		group.Add(lifecycle.Component{Name: "spool", Stop: func(context.Context) error { return spool.Close() }})
+		producerOpts = append(producerOpts, queue.WithSpool(spool))
+		log.Info().Str("dir", cfg.SpoolDir).Msg("Job spool enabled")
+	}
+
+	producer := queue.NewProducer(cfg.RedisAddr, producerOpts...)
+	group.Add(lifecycle.Component{Name: "producer", Stop: func(context.Context) error { return producer.Close() }})
+	if producer.Spooling() {
+		// Stops after the servers, so the final drain sees every accepted job.
+		group.Add(lifecycle.Component{
+			Name: "spool-relay",
+			Run: func(ctx context.Context) error {
+				producer.RunRelay(ctx, cfg.SpoolRelayInterval, cfg.SpoolDrainTimeout)
+				return nil
+			},
+			StopTimeout: cfg.SpoolDrainTimeout + 5*time.Second,
+		})
+	}
+
+	// Runtime log level changes reach every replica through Redis
+	levelSync := logger.NewLevelSync(cfg.RedisAddr)
+	group.Add(lifecycle.Component{
+		Name: "log-level-sync",
+		Run: func(ctx context.Context) error {
+			levelSync.Run(ctx)
+			return nil
+		},
+		Stop: func(context.Context) error { return levelSync.Close() },
+	})
+
+	// 6. Admission control (backpressure on queue backlog)
+	admission, err := api.NewAdmissionController(api.AdmissionOptions{
+		HighDepth:    cfg.AdmissionHighWatermark,
+		LowDepth:     cfg.AdmissionLowWatermark,
+		HighAge:      cfg.AdmissionHighAge,
+		LowAge:       cfg.AdmissionLowAge,
+		ShedPriority: cfg.AdmissionShedPriority,
+		RejectStatus: cfg.AdmissionRejectStatus,
+		RetryAfter:   cfg.AdmissionRetryAfter,
+		PollInterval: cfg.AdmissionPollInterval,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid admission control configuration")
+	}
+	if admission.Enabled() {
+		group.Add(lifecycle.Component{Name: "admission", Run: func(ctx context.Context) error {
+			admission.Run(ctx, producer)
+			return nil
+		}})
+	}
 
-	// 6. Create Server with Middleware
+	// 7. Rate limiting (per client, per route)
+	defaultLimit := api.RateLimitRule{RPS: float64(cfg.RateLimitRPS), Burst: cfg.RateLimitBurst}
+	if err := defaultLimit.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid RATE_LIMIT_RPS/RATE_LIMIT_BURST")
+	}
+	routeLimits, err := api.ParseRouteLimits(cfg.RateLimitRoutes)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid RATE_LIMIT_ROUTES")
+	}
+	var limiter api.Limiter = api.NewLocalLimiter(cfg.RateLimitMaxClients)
+	if cfg.RateLimitBackend == "redis" {
+		redisLimiter := api.NewRedisLimiter(cfg.RedisAddr, limiter)
+		group.Add(lifecycle.Component{Name: "redis-rate-limiter", Stop: func(context.Context) error { return redisLimiter.Close() }})
+		limiter = redisLimiter
+	}
+	rateLimitOpts := api.RateLimitOptions{
+		Default:     defaultLimit,
+		Routes:      routeLimits,
+		KeyBy:       cfg.RateLimitKey,
+		ExemptPaths: strings.Split(cfg.RateLimitExemptPaths, ","),
+		MaxClients:  cfg.RateLimitMaxClients,
+		Limiter:     limiter,
+	}
+
+	// Per-tenant quotas share the rate limiter's bucket store
+	tenantQuotas, err := api.ParseTenantQuotas(cfg.TenantQuotas)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid TENANT_QUOTAS")
+	}
+	defaultQuota, err := api.ParseTenantQuota(cfg.TenantDefaultQuota)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid TENANT_DEFAULT_QUOTA")
+	}
+	knownTenants := []string{queue.DefaultTenant}
+	for t := range tenantQuotas {
+		knownTenants = append(knownTenants, t)
+	}
+	queue.ConfigureTenantLabels(cfg.TenantMetricsMaxLabels, knownTenants...)
+	if cfg.TenantPollInterval <= 0 {
+		log.Fatal().Dur("interval", cfg.TenantPollInterval).Msg("TENANT_POLL_INTERVAL must be positive")
+	}
+	tenants := api.NewTenantQuotas(api.TenantQuotaOptions{
+		Default:      defaultQuota,
+		Tenants:      tenantQuotas,
+		Limiter:      limiter,
+		PollInterval: cfg.TenantPollInterval,
+	})
+	group.Add(lifecycle.Component{Name: "tenant-quotas", Run: func(ctx context.Context) error {
+		tenants.Run(ctx, producer)
+		return nil
+	}})
+
+	// Dependency checks behind /ready. With a spool, jobs are still accepted
+	// while Redis is down, so Redis only degrades the service.
+	checks := health.NewRegistry()
+	if err := checks.Register(health.Check{
+		Name:     "redis",
+		Func:     producer.Ping,
+		Timeout:  cfg.HealthCheckTimeout,
+		CacheTTL: cfg.HealthCheckCacheTTL,
+		Critical: !producer.Spooling(),
+	}); err != nil {
+		log.Fatal().Err(err).Msg("Failed to register health check")
+	}
+
+	// 8. Create Server with Middleware
 	// Order matters:
 	// 1. OTel (Tracing) - starts trace
 	// 2. RequestID - tags trace/log
-	// 3. Metrics - measures duration of handler
-	// 4. Logger - logs final status/duration
-	r := api.NewServer(
-		producer,
+	// 3. Metrics + Logger - measure and log every request, including those rejected below
+	// 4. BodyLimit - caps request bodies before anything reads them
+	// 5. RateLimit by IP - throttles before credentials are checked, so guessing keys is too
+	// 6. Auth + Policy - identifies and authorizes the caller (optional)
+	// 7. Concurrency - sheds load when latency rises (optional)
+	// 8. TenantQuota + RateLimit by client - reject abusive tenants and clients early
+	bodyLimits, err := api.ParseBodyLimits(cfg.BodyLimitRoutes)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid BODY_LIMIT_ROUTES")
+	}
+	bodyLimitOpts := api.BodyLimitOptions{Default: cfg.BodyLimitBytes, Routes: bodyLimits}
+	middlewares := []gin.HandlerFunc{
 		otelgin.Middleware("api-service"),
 		api.RequestIDMiddleware(),
-		api.RateLimitMiddleware(cfg.RateLimitRPS, cfg.RateLimitBurst),
 		api.MetricsMiddleware(),
 		api.LoggerMiddleware(),
+		api.BodyLimitMiddleware(bodyLimitOpts),
+		api.RateLimitMiddleware(rateLimitOpts.PreAuth()),
+	}
+	// Auth, policy and rate limits are shared with the gRPC server
+	var (
+		authOpts *api.AuthOptions
+		policy   *api.Policy
 	)
+	if cfg.AuthEnabled {
+		var keys api.KeyStores
+		if cfg.AuthAPIKeysFile != "" {
+			fileKeys, err := api.LoadFileKeyStore(cfg.AuthAPIKeysFile)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed to load API keys")
+			}
+			keys = append(keys, fileKeys)
+		}
+		if cfg.AuthAPIKeysRedisKey != "" {
+			redisKeys := api.NewRedisKeyStore(cfg.RedisAddr, cfg.AuthAPIKeysRedisKey)
+			group.Add(lifecycle.Component{Name: "redis-key-store", Stop: func(context.Context) error { return redisKeys.Close() }})
+			keys = append(keys, redisKeys)
+		}
+		authOpts = &api.AuthOptions{ExemptPaths: strings.Split(cfg.AuthExemptPaths, ",")}
+		if len(keys) > 0 {
+			authOpts.Keys = keys
+		}
+		if cfg.AuthJWKSURL != "" || cfg.AuthJWKSFile != "" {
+			jwks, err := api.NewJWKS(context.Background(), cfg.AuthJWKSURL, cfg.AuthJWKSFile, cfg.AuthJWKSRefreshInterval)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed to load JWKS")
+			}
+			roleScopes, err := api.ParseRoleScopes(cfg.AuthJWTRoleScopes)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Invalid AUTH_JWT_ROLE_SCOPES")
+			}
+			authOpts.JWT, err = api.NewJWTVerifier(api.JWTOptions{
+				JWKS:        jwks,
+				Issuer:      cfg.AuthJWTIssuer,
+				Audience:    cfg.AuthJWTAudience,
+				Leeway:      cfg.AuthJWTLeeway,
+				RolesClaim:  cfg.AuthJWTRolesClaim,
+				RoleScopes:  roleScopes,
+				TenantClaim: cfg.AuthJWTTenantClaim,
+			})
+			if err != nil {
+				log.Fatal().Err(err).Msg("AUTH_JWKS_URL/AUTH_JWKS_FILE require AUTH_JWT_ISSUER and AUTH_JWT_AUDIENCE")
+			}
+		}
+		if authOpts.Keys == nil && authOpts.JWT == nil {
+			log.Fatal().Msg("AUTH_ENABLED requires API keys (AUTH_API_KEYS_FILE, AUTH_API_KEYS_REDIS_KEY) or a JWKS (AUTH_JWKS_URL, AUTH_JWKS_FILE)")
+		}
+		middlewares = append(middlewares, api.AuthMiddleware(*authOpts))
+	}
+	if cfg.AuthPolicyFile != "" {
+		policy, err = api.LoadPolicy(cfg.AuthPolicyFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load authorization policy")
+		}
+		middlewares = append(middlewares, api.PolicyMiddleware(policy))
+	}
+	if cfg.ConcurrencyLimitEnabled {
+		concurrency, err := api.NewConcurrencyLimiter(api.ConcurrencyOptions{
+			Algorithm:        cfg.ConcurrencyLimitAlgorithm,
+			InitialLimit:     cfg.ConcurrencyLimitInitial,
+			MinLimit:         cfg.ConcurrencyLimitMin,
+			MaxLimit:         cfg.ConcurrencyLimitMax,
+			CriticalPaths:    strings.Split(cfg.ConcurrencyCriticalPaths, ","),
+			BackgroundRoutes: strings.Split(cfg.ConcurrencyBackground, ","),
+			AIMDTimeout:      cfg.ConcurrencyAIMDTimeout,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid CONCURRENCY_LIMIT_ALGORITHM")
+		}
+		middlewares = append(middlewares, api.ConcurrencyLimitMiddleware(concurrency))
+	}
+	middlewares = append(middlewares, api.TenantQuotaMiddleware(tenants))
+	if !rateLimitOpts.KeysByIP() {
+		middlewares = append(middlewares, api.RateLimitMiddleware(rateLimitOpts))
+	}
+	serverOpts := api.ServerOptions{Admission: admission, Tenants: tenants, Health: checks}
+	serverOpts.WorkflowLimits = api.WorkflowLimits{MaxSteps: cfg.WorkflowMaxSteps, MaxDeps: cfg.WorkflowMaxDeps}
+	// Changing log levels and profiling need authentication, so they are only served with auth on
+	if cfg.AuthEnabled {
+		serverOpts.LogLevels = &api.LogLevelOptions{Sync: levelSync, DefaultTTL: cfg.LogLevelTTL, MaxTTL: cfg.LogLevelMaxTTL}
+		serverOpts.Pprof = true
+	}
+	if cfg.JSONLenientJobTypes != "" {
+		serverOpts.LenientJobTypes = make(map[string]bool)
+		for _, t := range strings.Split(cfg.JSONLenientJobTypes, ",") {
+			serverOpts.LenientJobTypes[strings.TrimSpace(t)] = true
+		}
+	}
+	if cfg.LegacyRoutesEnabled {
+		deprecated, err := time.Parse(time.DateOnly, cfg.LegacyRoutesDeprecatedAt)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid LEGACY_ROUTES_DEPRECATED_AT")
+		}
+		legacy := &api.DeprecationOptions{Since: deprecated}
+		if cfg.LegacyRoutesSunset != "" {
+			if legacy.Sunset, err = time.Parse(time.DateOnly, cfg.LegacyRoutesSunset); err != nil {
+				log.Fatal().Err(err).Msg("Invalid LEGACY_ROUTES_SUNSET")
+			}
+		}
+		serverOpts.LegacyRoutes = legacy
+	}
+	for _, p := range strings.Split(cfg.TrustedProxies, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			serverOpts.TrustedProxies = append(serverOpts.TrustedProxies, p)
+		}
+	}
+	r, err := api.NewServer(producer, serverOpts, middlewares...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid TRUSTED_PROXIES")
+	}
+
+	// The gRPC server is added before the HTTP server, so it stops after it:
+	// its health service already reports NOT_SERVING while HTTP drains.
+	if cfg.GRPCEnabled {
+		grpcServer := api.NewGRPCServer(producer, api.GRPCOptions{
+			Addr:          ":" + cfg.GRPCPort,
+			Auth:          authOpts,
+			Policy:        policy,
+			RateLimit:     &rateLimitOpts,
+			BodyLimit:     &bodyLimitOpts,
+			Server:        serverOpts,
+			WatchInterval: cfg.GRPCWatchInterval,
+		})
+		group.Add(lifecycle.Component{
+			Name: "grpc-server",
+			Run: func(ctx context.Context) error {
+				log.Info().Str("component", "grpc-server").Str("port", cfg.GRPCPort).Msg("Listening")
+				if err := grpcServer.ListenAndServe(); err != nil {
+					return err
+				}
+				<-ctx.Done()
+				return nil
+			},
+			Stop:        grpcServer.Shutdown,
+			StopTimeout: cfg.ShutdownTimeout,
+		})
+	}
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.APIPort,
 		Handler: r,
 	}
 
-	// Channel to listen for errors coming from the listener.
-	serverErrors := make(chan error, 1)
-
-	go func() {
-		log.Info().Str("port", cfg.APIPort).Msg("Starting api_service")
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			serverErrors <- err
-		}
-	}()
-
-	// Channel to listen for an interrupt or terminate signal from the OS.
-	shutdown := make(chan os.Signal, 1)
-	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
-
-	// Block until we receive our signal.
-	select {
-	case err := <-serverErrors:
-		log.Fatal().Err(err).Msg("Error starting server")
+	// The server stops first: fail /ready, drain, then wait for in-flight requests
+	server := lifecycle.HTTPServer("http-server", srv, func(context.Context) error {
+		return api.Shutdown(srv, api.ShutdownOptions{
+			Health:     checks,
+			DrainDelay: cfg.ShutdownDrainDelay,
+			Timeout:    cfg.ShutdownTimeout,
+		})
+	})
+	server.StopTimeout = cfg.ShutdownDrainDelay + cfg.ShutdownTimeout + 5*time.Second
+	group.Add(server)
 
-	case <-shutdown:
-		log.Info().Msg("Start shutdown...")
-
-		// Give outstanding requests a deadline for completion.
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		// Asking listener to shutdown and shed load.
-		if err := srv.Shutdown(ctx); err != nil {
-			log.Error().Err(err).Dur("timeout", 5*time.Second).Msg("Graceful shutdown did not complete")
-			if err := srv.Close(); err != nil {
-				log.Fatal().Err(err).Msg("Could not stop http server")
-			}
-		}
+	log.Info().Str("port", cfg.APIPort).Msg("Starting api_service")
+	if err := group.Run(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("api_service stopped with an error")
 	}
 	log.Info().Msg("Server stopped")
 }
@@ -2,21 +2,21 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"os"
-	"os/signal"
-	"sync"
-	"syscall"
-	"time"
 
 	stdlog "log"
 
 	"github.com/go-redis/redis/extra/redisotel/v8"
 	"github.com/go-redis/redis/v8"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 	"github.com/sanjeevsethi/sre-platform-app/internal/config"
+	"github.com/sanjeevsethi/sre-platform-app/internal/diagnostics"
+	"github.com/sanjeevsethi/sre-platform-app/internal/health"
+	"github.com/sanjeevsethi/sre-platform-app/internal/lifecycle"
 	"github.com/sanjeevsethi/sre-platform-app/internal/logger"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
 	"github.com/sanjeevsethi/sre-platform-app/internal/telemetry"
 	"github.com/sanjeevsethi/sre-platform-app/internal/worker"
 )
@@ -29,18 +29,26 @@ func main() {
 	}
 
 	// 2. Initialize Logger
-	logger.Init("info", os.Getenv("GIN_MODE") != "release")
+	if _, err := logger.ParseLevel(cfg.LogLevel); err != nil {
+		stdlog.Fatalf("Invalid LOG_LEVEL: %v", err)
+	}
+	logger.Init(cfg.LogLevel, os.Getenv("GIN_MODE") != "release")
+
+	// Components stop in reverse order: metrics server, worker loop, Redis, tracer
+	group := lifecycle.New()
 
 	// 3. Initialize Tracing
 	shutdownTracer, err := telemetry.InitTracer("worker-service")
 	if err != nil {
 		stdlog.Printf("Failed to init tracer: %v", err)
 	} else {
-		defer func() {
-			if err := shutdownTracer(context.Background()); err != nil {
-				stdlog.Printf("Error shutting down tracer: %v", err)
-			}
-		}()
+		group.Add(lifecycle.Component{Name: "tracer", Stop: shutdownTracer})
+	}
+
+	// Admin listener for /debug/info and pprof. Added early so it stops late,
+	// and a stuck shutdown can still be profiled.
+	if cfg.AdminAddr != "" {
+		group.Add(lifecycle.HTTPServer("admin-server", &http.Server{Addr: cfg.AdminAddr, Handler: diagnostics.Handler()}, nil))
 	}
 
 	// 7. Connect to Redis
@@ -49,66 +57,79 @@ func main() {
 	})
 	// Add Redis instrumentation hook
 	rdb.AddHook(redisotel.NewTracingHook())
+	group.Add(lifecycle.Component{
+		Name: "redis",
+		// Fail fast at startup when Redis is unreachable
+		Start: func(ctx context.Context) error {
+			if err := rdb.Ping(ctx).Err(); err != nil {
+				return fmt.Errorf("connect to %s: %w", cfg.RedisAddr, err)
+			}
+			log.Info().Str("addr", cfg.RedisAddr).Msg("Connected to Redis")
+			return nil
+		},
+		Stop: func(context.Context) error { return rdb.Close() },
+	})
 
-	// Check Redis connection
-	// Create a context that we can cancel to signal shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Log levels changed through the api-service admin endpoint apply here too
+	levelSync := logger.NewLevelSync(cfg.RedisAddr)
+	group.Add(lifecycle.Component{
+		Name: "log-level-sync",
+		Run: func(ctx context.Context) error {
+			levelSync.Run(ctx)
+			return nil
+		},
+		Stop: func(context.Context) error { return levelSync.Close() },
+	})
 
-	if _, err := rdb.Ping(ctx).Result(); err != nil {
-		log.Fatal().Err(err).Str("addr", cfg.RedisAddr).Msg("Unable to connect to Redis")
+	// Payload codec must match the api-service settings to read jobs back.
+	codec, err := queue.NewCodecFromConfig(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid payload codec configuration")
 	}
-	log.Info().Str("addr", cfg.RedisAddr).Msg("Connected to Redis")
+	queue.ConfigureTenantLabels(cfg.TenantMetricsMaxLabels)
+
+	// 8. The worker loop finishes its current job once cancelled
+	group.Add(lifecycle.Component{
+		Name: "worker",
+		Run: func(ctx context.Context) error {
+			worker.Start(ctx, rdb, codec)
+			return nil
+		},
+		StopTimeout: cfg.ShutdownTimeout,
+	})
 
-	// 8. Launch the worker loop in a background goroutine
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		worker.Start(ctx, rdb)
-	}()
+	// 9. Dependency checks: a worker without Redis cannot do anything
+	checks := health.NewRegistry()
+	if err := checks.Register(health.Check{
+		Name:     "redis",
+		Func:     func(ctx context.Context) error { return rdb.Ping(ctx).Err() },
+		Timeout:  cfg.HealthCheckTimeout,
+		CacheTTL: cfg.HealthCheckCacheTTL,
+		Critical: true,
+	}); err != nil {
+		log.Fatal().Err(err).Msg("Failed to register health check")
+	}
 
-	// 9. Expose /metrics for Prometheus
+	// 10. Expose /metrics for Prometheus, plus probes. If this server dies the
+	// process exits instead of running on unobservable.
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/metrics", telemetry.MetricsHandler())
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
 	})
+	mux.Handle("/ready", checks.ReadyHandler())
+	mux.Handle("/health", checks.DetailsHandler())
 
 	metricsSrv := &http.Server{
 		Addr:    ":" + cfg.WorkerPort,
 		Handler: mux,
 	}
+	group.Add(lifecycle.HTTPServer("metrics-server", metricsSrv, nil))
 
-	go func() {
-		log.Info().Str("port", cfg.WorkerPort).Msg("Starting worker-service metrics server")
-		if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Error().Err(err).Msg("Metrics server error")
-		}
-	}()
-
-	// Listen for interrupts
-	shutdown := make(chan os.Signal, 1)
-	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
-
-	<-shutdown
-	log.Info().Msg("Shutdown signal received...")
-
-	// 1. Signal worker to stop
-	cancel()
-
-	// 2. Wait for worker to finish
-	log.Info().Msg("Waiting for worker to exit...")
-	wg.Wait()
-	log.Info().Msg("Worker exited.")
-
-	// 3. Shutdown metrics server
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer shutdownCancel()
-
-	if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
-		log.Error().Err(err).Msg("Metrics server forced to shutdown")
+	log.Info().Str("port", cfg.WorkerPort).Msg("Starting worker-service")
+	if err := group.Run(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("worker-service stopped with an error")
 	}
-	log.Info().Msg("Metrics server stopped.")
+	log.Info().Msg("Worker stopped")
 }
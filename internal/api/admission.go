@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+)
+
+// Admission metrics
+var (
+	admissionDecisionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_admission_decisions_total",
+			Help: "Admission control decisions for submitted jobs.",
+		},
+		[]string{"decision", "priority"},
+	)
+	admissionShedding = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_admission_shedding",
+			Help: "1 while the API is shedding low-priority jobs because of queue backlog.",
+		},
+	)
+	admissionQueueDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_admission_queue_depth",
+			Help: "Queue depth last observed by admission control.",
+		},
+	)
+	admissionOldestAge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_admission_oldest_job_age_seconds",
+			Help: "Age of the oldest queued job last observed by admission control.",
+		},
+	)
+)
+
+// AdmissionOptions configures backlog-based admission control.
+// A zero high watermark disables that signal.
+type AdmissionOptions struct {
+	// Queue depth watermarks: shedding starts at HighDepth and stops at LowDepth
+	// (default: defaultLowWatermark of HighDepth).
+	HighDepth int64
+	LowDepth  int64
+	// Oldest-job age watermarks, with the same hysteresis and default.
+	HighAge time.Duration
+	LowAge  time.Duration
+	// ShedPriority is the highest priority that gets shed while overloaded.
+	ShedPriority string
+	// RejectStatus is the HTTP status returned for shed jobs (429 or 503).
+	RejectStatus int
+	RetryAfter   time.Duration
+	PollInterval time.Duration
+}
+
+// AdmissionController decides whether new jobs are accepted based on the
+// queue backlog. It polls the backlog in the background so POST /jobs never
+// pays for an extra Redis round trip.
+type AdmissionController struct {
+	opts AdmissionOptions
+
+	mu       sync.RWMutex
+	shedding bool
+}
+
+// defaultLowWatermark is the fraction of a high watermark that an unset low
+// watermark defaults to.
+const defaultLowWatermark = 0.8
+
+// NewAdmissionController returns a controller; call Run to start polling.
+func NewAdmissionController(opts AdmissionOptions) (*AdmissionController, error) {
+	switch opts.ShedPriority {
+	case queue.PriorityLow, queue.PriorityNormal, queue.PriorityHigh:
+	default:
+		return nil, fmt.Errorf("admission: shed priority must be one of low, normal, high, got %q", opts.ShedPriority)
+	}
+	a := &AdmissionController{opts: opts}
+	if !a.Enabled() {
+		return a, nil
+	}
+	if opts.RejectStatus != http.StatusTooManyRequests && opts.RejectStatus != http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("admission: reject status must be 429 or 503, got %d", opts.RejectStatus)
+	}
+	if opts.PollInterval <= 0 {
+		return nil, fmt.Errorf("admission: poll interval must be positive, got %s", opts.PollInterval)
+	}
+	if opts.LowDepth == 0 {
+		a.opts.LowDepth = int64(float64(opts.HighDepth) * defaultLowWatermark)
+	}
+	if opts.LowAge == 0 {
+		a.opts.LowAge = time.Duration(float64(opts.HighAge) * defaultLowWatermark)
+	}
+	if (opts.HighDepth > 0 && a.opts.LowDepth > opts.HighDepth) || (opts.HighAge > 0 && a.opts.LowAge > opts.HighAge) {
+		return nil, fmt.Errorf("admission: low watermarks must not exceed high watermarks")
+	}
+	return a, nil
+}
+
+// Enabled reports whether any watermark is configured.
+func (a *AdmissionController) Enabled() bool {
+	return a != nil && (a.opts.HighDepth > 0 || a.opts.HighAge > 0)
+}
+
+// Run polls the producer's backlog until ctx is done. When the backlog cannot
+// be read the last decision is kept.
+func (a *AdmissionController) Run(ctx context.Context, p *queue.Producer) {
+	if !a.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(a.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		depth, age, err := p.Backlog(ctx)
+		if err != nil {
+			continue
+		}
+		admissionQueueDepth.Set(float64(depth))
+		admissionOldestAge.Set(age.Seconds())
+		a.observe(depth, age)
+	}
+}
+
+func (a *AdmissionController) observe(depth int64, age time.Duration) {
+	overHigh := (a.opts.HighDepth > 0 && depth >= a.opts.HighDepth) ||
+		(a.opts.HighAge > 0 && age >= a.opts.HighAge)
+	belowLow := (a.opts.HighDepth == 0 || depth <= a.opts.LowDepth) &&
+		(a.opts.HighAge == 0 || age <= a.opts.LowAge)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case !a.shedding && overHigh:
+		a.shedding = true
+		admissionShedding.Set(1)
+		log.Warn().Int64("queue_depth", depth).Dur("oldest_age", age).Msg("Queue backlog above high watermark, shedding low-priority jobs")
+	case a.shedding && belowLow:
+		a.shedding = false
+		admissionShedding.Set(0)
+		log.Info().Int64("queue_depth", depth).Dur("oldest_age", age).Msg("Queue backlog below low watermark, admitting all jobs")
+	}
+}
+
+// Admit reports whether a job of the given priority should be accepted.
+func (a *AdmissionController) Admit(priority string) bool {
+	admitted := true
+	if a.Enabled() {
+		a.mu.RLock()
+		admitted = !a.shedding || queue.PriorityRank(priority) > queue.PriorityRank(a.opts.ShedPriority)
+		a.mu.RUnlock()
+	}
+
+	decision := "admitted"
+	if !admitted {
+		decision = "shed"
+	}
+	admissionDecisionsTotal.WithLabelValues(decision, priority).Inc()
+	return admitted
+}
+
+// reject writes the problem response for a shed job.
+func (a *AdmissionController) reject(c *gin.Context) {
+	c.Header("Retry-After", strconv.Itoa(ceilSeconds(a.opts.RetryAfter)))
+	p := newProblem(c, ProblemQueueOverloaded, "job queue backlog is too large, retry later")
+	p.Status = a.opts.RejectStatus
+	writeProblem(c, p)
+}
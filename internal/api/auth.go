@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/extra/redisotel/v8"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Scopes granted to callers.
+const (
+	ScopeJobsWrite = "jobs:write"
+	ScopeJobsRead  = "jobs:read"
+	// ScopeJobsPriority allows submitting high-priority jobs, which admission
+	// control never sheds.
+	ScopeJobsPriority = "jobs:priority"
+	// ScopeAdmin implies every other scope.
+	ScopeAdmin = "admin"
+)
+
+// principalKey is the gin context key holding the authenticated *Principal.
+const principalKey = "principal"
+
+// authEnabledKey is set on every request that went through AuthMiddleware.
+const authEnabledKey = "auth_enabled"
+
+// ErrUnknownKey is returned by a KeyStore when no key matches.
+var ErrUnknownKey = errors.New("unknown api key")
+
+var authFailuresTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_auth_failures_total",
+		Help: "Total number of rejected authentication or authorization attempts.",
+	},
+	[]string{"reason"},
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	ID     string   `json:"id"`
+	Method string   `json:"method"`
+	Roles  []string `json:"roles,omitempty"`
+	Scopes []string `json:"scopes"`
+	// Tenant owns the principal's jobs; empty means the default tenant.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// HasScope reports whether the principal was granted scope (admin grants everything).
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// PrincipalFrom returns the principal set by AuthMiddleware, if any.
+func PrincipalFrom(c *gin.Context) (*Principal, bool) {
+	v, ok := c.Get(principalKey)
+	if !ok {
+		return nil, false
+	}
+	p, ok := v.(*Principal)
+	return p, ok
+}
+
+// APIKey is a stored key. Only the SHA-256 hash of the secret is kept.
+type APIKey struct {
+	ID     string   `json:"id"`
+	Hash   string   `json:"hash"`
+	Roles  []string `json:"roles,omitempty"`
+	Scopes []string `json:"scopes"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+// HashAPIKey returns the hex SHA-256 digest under which a key is stored.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyStore looks up API keys by hash.
+type KeyStore interface {
+	Lookup(ctx context.Context, hash string) (*APIKey, error)
+}
+
+// FileKeyStore holds keys loaded from a JSON file of the form
+// {"keys":[{"id":"ci","hash":"<sha256 hex>","scopes":["jobs:write"]}]}.
+type FileKeyStore struct {
+	keys map[string]*APIKey
+}
+
+// LoadFileKeyStore reads and indexes a key file.
+func LoadFileKeyStore(path string) (*FileKeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read api key file: %w", err)
+	}
+	var doc struct {
+		Keys []*APIKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse api key file: %w", err)
+	}
+
+	s := &FileKeyStore{keys: make(map[string]*APIKey, len(doc.Keys))}
+	for _, k := range doc.Keys {
+		if k.ID == "" || len(k.Hash) != sha256.Size*2 {
+			return nil, fmt.Errorf("api key file: entry %q needs an id and a hex sha256 hash", k.ID)
+		}
+		if k.Tenant != "" && !queue.ValidTenant(k.Tenant) {
+			return nil, fmt.Errorf("api key file: entry %q has an invalid tenant %q", k.ID, k.Tenant)
+		}
+		s.keys[k.Hash] = k
+	}
+	return s, nil
+}
+
+func (s *FileKeyStore) Lookup(_ context.Context, hash string) (*APIKey, error) {
+	if k, ok := s.keys[hash]; ok {
+		return k, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// RedisKeyStore looks keys up in a Redis hash: field = key hash, value = APIKey JSON.
+// Keys can be added or revoked at runtime with HSET/HDEL.
+type RedisKeyStore struct {
+	client  *redis.Client
+	hashKey string
+}
+
+// NewRedisKeyStore connects to Redis at addr and reads keys from the hash hashKey.
+func NewRedisKeyStore(addr, hashKey string) *RedisKeyStore {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	// Enable tracing
+	rdb.AddHook(redisotel.NewTracingHook())
+	return &RedisKeyStore{client: rdb, hashKey: hashKey}
+}
+
+func (s *RedisKeyStore) Lookup(ctx context.Context, hash string) (*APIKey, error) {
+	data, err := s.client.HGet(ctx, s.hashKey, hash).Bytes()
+	if err == redis.Nil {
+		return nil, ErrUnknownKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	var k APIKey
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("decode api key: %w", err)
+	}
+	if k.Tenant != "" && !queue.ValidTenant(k.Tenant) {
+		return nil, fmt.Errorf("api key %s: invalid tenant %q", k.ID, k.Tenant)
+	}
+	k.Hash = hash
+	return &k, nil
+}
+
+// Close releases the Redis connection pool.
+func (s *RedisKeyStore) Close() error {
+	return s.client.Close()
+}
+
+// KeyStores chains several stores; the first match wins.
+type KeyStores []KeyStore
+
+func (ks KeyStores) Lookup(ctx context.Context, hash string) (*APIKey, error) {
+	for _, s := range ks {
+		k, err := s.Lookup(ctx, hash)
+		if errors.Is(err, ErrUnknownKey) {
+			continue
+		}
+		return k, err
+	}
+	return nil, ErrUnknownKey
+}
+
+// AuthOptions configures AuthMiddleware.
+type AuthOptions struct {
+	// Keys verifies opaque API keys; nil disables them.
+	Keys KeyStore
+	// JWT verifies bearer tokens that are JWTs; nil disables them.
+	JWT *JWTVerifier
+	// ExemptPaths are served without credentials (probes, metrics).
+	ExemptPaths []string
+}
+
+// AuthMiddleware authenticates requests with a JWT or an API key, sent as a
+// bearer token (API keys also in X-API-Key), and stores the resulting
+// Principal in the context. Per-route scope checks are done by RequireScope.
+func AuthMiddleware(opts AuthOptions) gin.HandlerFunc {
+	exempt := make(map[string]bool, len(opts.ExemptPaths))
+	for _, p := range opts.ExemptPaths {
+		if p = strings.TrimSpace(p); p != "" {
+			exempt[p] = true
+		}
+	}
+
+	return func(c *gin.Context) {
+		c.Set(authEnabledKey, true)
+		if exempt[c.FullPath()] || exempt[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+
+		principal, err := opts.authenticate(c.Request.Context(), requestAPIKey(c))
+		if err != nil {
+			if errors.Is(err, errInvalidCredentials) {
+				unauthorized(c)
+				return
+			}
+			log.Error().Err(err).Msg("API key lookup failed")
+			abortWithProblem(c, ProblemServiceUnavailable, "credentials could not be checked")
+			return
+		}
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// errInvalidCredentials wraps every rejected credential; other errors from
+// authenticate mean the credentials could not be checked.
+var errInvalidCredentials = errors.New("missing or invalid credentials")
+
+// authenticate verifies a JWT or API key for HTTP and gRPC alike, counting
+// failures and tagging the current span with the caller.
+func (opts AuthOptions) authenticate(ctx context.Context, key string) (*Principal, error) {
+	if key == "" {
+		authFailuresTotal.WithLabelValues("missing_credentials").Inc()
+		return nil, errInvalidCredentials
+	}
+
+	var principal *Principal
+	if opts.JWT != nil && looksLikeJWT(key) {
+		p, err := opts.JWT.Verify(ctx, key)
+		if err != nil {
+			authFailuresTotal.WithLabelValues("invalid_token").Inc()
+			log.Debug().Err(err).Msg("Rejected bearer token")
+			return nil, errInvalidCredentials
+		}
+		principal = p
+	} else {
+		var k *APIKey
+		err := ErrUnknownKey
+		if opts.Keys != nil {
+			k, err = opts.Keys.Lookup(ctx, HashAPIKey(key))
+		}
+		if err != nil {
+			if !errors.Is(err, ErrUnknownKey) {
+				return nil, err
+			}
+			authFailuresTotal.WithLabelValues("invalid_api_key").Inc()
+			return nil, errInvalidCredentials
+		}
+		principal = &Principal{ID: k.ID, Method: "api_key", Roles: k.Roles, Scopes: k.Scopes, Tenant: k.Tenant}
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("enduser.id", principal.ID))
+	if len(principal.Roles) > 0 {
+		span.SetAttributes(attribute.String("enduser.role", strings.Join(principal.Roles, ",")))
+	}
+	span.SetAttributes(attribute.String("tenant", queue.NormalizeTenant(principal.Tenant)))
+	return principal, nil
+}
+
+// RequireScope rejects callers that lack scope. Requests without a principal
+// pass only when auth is disabled; with auth enabled they get a 401, even on a
+// path listed in AUTH_EXEMPT_PATHS, so exempting a scoped route never opens it.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := PrincipalFrom(c)
+		if !ok {
+			if c.GetBool(authEnabledKey) {
+				authFailuresTotal.WithLabelValues("missing_credentials").Inc()
+				unauthorized(c)
+				return
+			}
+			c.Next()
+			return
+		}
+		if !p.HasScope(scope) {
+			authFailuresTotal.WithLabelValues("missing_scope").Inc()
+			p := newProblem(c, ProblemForbidden, "missing required scope "+scope)
+			p.RequiredScope = scope
+			writeProblem(c, p)
+			return
+		}
+		c.Next()
+	}
+}
+
+func unauthorized(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Bearer realm="sre-platform"`)
+	abortWithProblem(c, ProblemUnauthorized, "missing or invalid credentials")
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var bodyLimitRejectionsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_body_limit_rejections_total",
+		Help: "Total number of requests rejected because their body exceeded the route's size limit.",
+	},
+	[]string{"route"},
+)
+
+// BodyLimitOptions configures BodyLimitMiddleware. Limits are in bytes; zero
+// or less means unlimited.
+type BodyLimitOptions struct {
+	// Default applies to every route without a specific limit.
+	Default int64
+	// Routes maps "METHOD /route/template" (or just "/route/template") to a limit.
+	Routes map[string]int64
+}
+
+// ParseBodyLimits parses "POST /jobs=65536,/workflows=1048576" into per-route limits.
+func ParseBodyLimits(spec string) (map[string]int64, error) {
+	limits := make(map[string]int64)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, limit, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("body limit entry %q: want route=bytes", entry)
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(limit), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("body limit entry %q: invalid bytes: %w", entry, err)
+		}
+		limits[routeKey(route)] = n
+	}
+	return limits, nil
+}
+
+// limitFor returns the body limit of a route, preferring "METHOD /route" over "/route".
+// Aliases share their versioned route's limit.
+func (opts *BodyLimitOptions) limitFor(method, route string) int64 {
+	if opts == nil {
+		return 0
+	}
+	route = unversionedRoute(route)
+	if n, ok := opts.Routes[method+" "+route]; ok {
+		return n
+	}
+	if n, ok := opts.Routes[route]; ok {
+		return n
+	}
+	return opts.Default
+}
+
+// BodyLimitMiddleware caps request bodies per route. Bodies announced as too
+// large are rejected up front; chunked ones fail with 413 once the handler
+// reads past the limit (see bindJSON).
+func BodyLimitMiddleware(opts BodyLimitOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := opts.limitFor(c.Request.Method, c.FullPath())
+		if limit <= 0 || c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > limit {
+			rejectTooLarge(c, limit)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// rejectTooLarge answers with a 413 problem.
+func rejectTooLarge(c *gin.Context, limit int64) {
+	bodyLimitRejectionsTotal.WithLabelValues(routeLabel(c)).Inc()
+	// The rest of the body is not read, so don't keep the connection.
+	c.Header("Connection", "close")
+	abortWithProblem(c, ProblemPayloadTooLarge, fmt.Sprintf("request body exceeds %d bytes", limit))
+}
+
+// tooLarge reports whether err comes from reading past a MaxBytesReader, and its limit.
+func tooLarge(err error) (int64, bool) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return maxErr.Limit, true
+	}
+	return 0, false
+}
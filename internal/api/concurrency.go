@@ -0,0 +1,271 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Concurrency limit algorithms.
+const (
+	ConcurrencyGradient = "gradient"
+	ConcurrencyAIMD     = "aimd"
+)
+
+// Request classes for load shedding.
+const (
+	// ClassCritical requests (probes, metrics, admins) are never shed.
+	ClassCritical = "critical"
+	ClassNormal   = "normal"
+	// ClassBackground requests are shed first, once in-flight requests
+	// reach lowPriorityShare of the limit.
+	ClassBackground = "background"
+)
+
+const lowPriorityShare = 0.8
+
+// Concurrency limiter metrics
+var (
+	concurrencyLimit = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_concurrency_limit",
+			Help: "Current adaptive concurrency limit.",
+		},
+	)
+	concurrencyInFlight = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_concurrency_in_flight",
+			Help: "Requests currently counted against the concurrency limit.",
+		},
+	)
+	concurrencyRejectionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_concurrency_rejections_total",
+			Help: "Requests shed by the adaptive concurrency limiter.",
+		},
+		[]string{"class"},
+	)
+)
+
+// ConcurrencyOptions configures ConcurrencyLimitMiddleware.
+type ConcurrencyOptions struct {
+	// Algorithm is "gradient" (default) or "aimd".
+	Algorithm    string
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+	// CriticalPaths are never shed (route templates or paths).
+	CriticalPaths []string
+	// BackgroundRoutes ("METHOD /route" or "/route") are shed before normal traffic.
+	BackgroundRoutes []string
+	// AIMDTimeout is the latency above which AIMD treats a request as a drop.
+	AIMDTimeout time.Duration
+}
+
+// Samples are aggregated into windows of at least this duration and size, and
+// the limit is updated once per window so it does not chase individual requests.
+const (
+	limitWindow        = 100 * time.Millisecond
+	limitWindowSamples = 10
+)
+
+// ConcurrencyLimiter adapts the number of requests served at once to the
+// latency the service is currently achieving. When Redis or another
+// dependency slows down, latency rises, the limit shrinks and excess
+// requests are rejected immediately instead of queueing up.
+type ConcurrencyLimiter struct {
+	opts ConcurrencyOptions
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+
+	// current sample window
+	windowStart       time.Time
+	windowRTTSum      time.Duration
+	windowSamples     int
+	windowMaxInFlight int
+	windowDropped     bool
+
+	// gradient state: the lowest (no-load) window latency since the last
+	// reset, and the number of windows seen
+	noLoadRTT time.Duration
+	windows   int
+}
+
+// NewConcurrencyLimiter returns a limiter starting at opts.InitialLimit. It
+// fails on an unknown algorithm.
+func NewConcurrencyLimiter(opts ConcurrencyOptions) (*ConcurrencyLimiter, error) {
+	switch opts.Algorithm {
+	case "":
+		opts.Algorithm = ConcurrencyGradient
+	case ConcurrencyGradient, ConcurrencyAIMD:
+	default:
+		return nil, fmt.Errorf("concurrency: unknown algorithm %q: want %q or %q", opts.Algorithm, ConcurrencyGradient, ConcurrencyAIMD)
+	}
+	if opts.MinLimit <= 0 {
+		opts.MinLimit = 1
+	}
+	if opts.MaxLimit < opts.MinLimit {
+		opts.MaxLimit = opts.MinLimit
+	}
+	if opts.InitialLimit < opts.MinLimit || opts.InitialLimit > opts.MaxLimit {
+		opts.InitialLimit = opts.MinLimit
+	}
+	if opts.AIMDTimeout <= 0 {
+		opts.AIMDTimeout = time.Second
+	}
+	l := &ConcurrencyLimiter{opts: opts, limit: float64(opts.InitialLimit), windowStart: time.Now()}
+	concurrencyLimit.Set(l.limit)
+	return l, nil
+}
+
+// acquire reserves a slot for a request of the given class.
+func (l *ConcurrencyLimiter) acquire(class string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if class != ClassCritical {
+		threshold := l.limit
+		if class == ClassBackground {
+			threshold *= lowPriorityShare
+		}
+		if float64(l.inFlight) >= threshold {
+			return false
+		}
+	}
+	l.inFlight++
+	concurrencyInFlight.Set(float64(l.inFlight))
+	return true
+}
+
+// release frees a slot and feeds the request's latency into the limit.
+// Critical requests do not adjust the limit; they are often trivially fast.
+func (l *ConcurrencyLimiter) release(class string, rtt time.Duration, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inFlight := l.inFlight
+	l.inFlight--
+	concurrencyInFlight.Set(float64(l.inFlight))
+	if class == ClassCritical {
+		return
+	}
+
+	l.windowRTTSum += rtt
+	l.windowSamples++
+	l.windowMaxInFlight = max(l.windowMaxInFlight, inFlight)
+	l.windowDropped = l.windowDropped || dropped || (l.opts.Algorithm == ConcurrencyAIMD && rtt > l.opts.AIMDTimeout)
+	now := time.Now()
+	if l.windowSamples < limitWindowSamples || now.Sub(l.windowStart) < limitWindow {
+		return
+	}
+
+	avgRTT := l.windowRTTSum / time.Duration(l.windowSamples)
+	if l.opts.Algorithm == ConcurrencyAIMD {
+		l.updateAIMD(l.windowMaxInFlight, l.windowDropped)
+	} else {
+		l.updateGradient(avgRTT, l.windowMaxInFlight)
+	}
+	l.limit = math.Max(float64(l.opts.MinLimit), math.Min(float64(l.opts.MaxLimit), l.limit))
+	concurrencyLimit.Set(l.limit)
+
+	l.windowStart = now
+	l.windowRTTSum, l.windowSamples, l.windowMaxInFlight, l.windowDropped = 0, 0, 0, false
+}
+
+// updateAIMD grows the limit by one per window while the service keeps up
+// and cuts it by 10% after a failure or a request slower than AIMDTimeout.
+func (l *ConcurrencyLimiter) updateAIMD(inFlight int, dropped bool) {
+	switch {
+	case dropped:
+		l.limit *= 0.9
+	case float64(inFlight)*2 >= l.limit:
+		// Only grow when the limit is actually being used.
+		l.limit++
+	}
+}
+
+// updateGradient follows Netflix's gradient algorithm: the ratio of no-load
+// latency to the window's latency shrinks the limit as requests start
+// queueing, and a queue allowance of sqrt(limit) lets it probe upwards while
+// latency stays close to the baseline.
+func (l *ConcurrencyLimiter) updateGradient(rtt time.Duration, inFlight int) {
+	const (
+		// tolerance is how much latency may exceed the baseline before the limit shrinks.
+		tolerance = 1.5
+		smoothing = 0.2
+		// The baseline is re-learned periodically so it can follow real
+		// changes such as a slower Redis after a failover.
+		baselineResetWindows = 600
+	)
+	l.windows++
+	if l.noLoadRTT == 0 || rtt < l.noLoadRTT || l.windows%baselineResetWindows == 0 {
+		l.noLoadRTT = rtt
+	}
+	if rtt <= 0 {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1.0, tolerance*float64(l.noLoadRTT)/float64(rtt)))
+	// An under-used limit says nothing about capacity: only shrink it.
+	if float64(inFlight) < l.limit/2 && gradient == 1.0 {
+		return
+	}
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = l.limit*(1-smoothing) + newLimit*smoothing
+}
+
+// ConcurrencyLimitMiddleware sheds requests beyond the adaptive limit with 503.
+func ConcurrencyLimitMiddleware(l *ConcurrencyLimiter) gin.HandlerFunc {
+	critical := make(map[string]bool, len(l.opts.CriticalPaths))
+	for _, p := range l.opts.CriticalPaths {
+		if p = strings.TrimSpace(p); p != "" {
+			critical[p] = true
+		}
+	}
+	background := make(map[string]bool, len(l.opts.BackgroundRoutes))
+	for _, r := range l.opts.BackgroundRoutes {
+		if r = strings.TrimSpace(r); r != "" {
+			background[routeKey(r)] = true
+		}
+	}
+
+	classify := func(c *gin.Context) string {
+		route := c.FullPath()
+		if critical[route] || critical[c.Request.URL.Path] {
+			return ClassCritical
+		}
+		if p, ok := PrincipalFrom(c); ok && p.HasScope(ScopeAdmin) {
+			return ClassCritical
+		}
+		route = unversionedRoute(route)
+		if background[c.Request.Method+" "+route] || background[route] {
+			return ClassBackground
+		}
+		return ClassNormal
+	}
+
+	return func(c *gin.Context) {
+		class := classify(c)
+		if !l.acquire(class) {
+			concurrencyRejectionsTotal.WithLabelValues(class).Inc()
+			c.Header("Retry-After", "1")
+			abortWithProblem(c, ProblemServerOverloaded, "too many concurrent requests, retry later")
+			return
+		}
+
+		start := time.Now()
+		defer func() {
+			l.release(class, time.Since(start), c.Writer.Status() >= http.StatusInternalServerError)
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,359 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sanjeevsethi/sre-platform-app/internal/health"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+	jobsv1 "github.com/sanjeevsethi/sre-platform-app/proto/jobs/v1"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcMethod describes an RPC as its REST equivalent, so the scopes, rate
+// limits and authorization policy written for HTTP routes apply to it too.
+type grpcMethod struct {
+	httpMethod string
+	route      string
+	scope      string
+}
+
+// grpcMethods lists the guarded RPCs; anything else (the health service) is
+// exempt from auth and rate limiting, like the HTTP probes.
+var grpcMethods = map[string]grpcMethod{
+	jobsv1.JobService_SubmitJob_FullMethodName: {http.MethodPost, APIVersionPrefix + "/jobs", ScopeJobsWrite},
+	jobsv1.JobService_GetJob_FullMethodName:    {http.MethodGet, APIVersionPrefix + "/jobs/:id", ScopeJobsRead},
+	jobsv1.JobService_CancelJob_FullMethodName: {http.MethodDelete, APIVersionPrefix + "/jobs/:id", ScopeJobsWrite},
+	jobsv1.JobService_WatchJob_FullMethodName:  {http.MethodGet, APIVersionPrefix + "/jobs/:id", ScopeJobsRead},
+}
+
+// GRPCOptions configures the gRPC server. A nil field disables the
+// corresponding interceptor, as in the HTTP middleware chain.
+type GRPCOptions struct {
+	// Addr is the listen address, e.g. ":9090".
+	Addr string
+	// Auth verifies "authorization: Bearer ..." or "x-api-key" metadata.
+	Auth *AuthOptions
+	// Policy authorizes each RPC as its REST equivalent.
+	Policy *Policy
+	// RateLimit shares its rules and limiter with RateLimitMiddleware.
+	RateLimit *RateLimitOptions
+	// BodyLimit caps SubmitJob messages like the body of POST /v1/jobs.
+	BodyLimit *BodyLimitOptions
+	// Server carries the admission control, tenant quotas and health checks of the HTTP server.
+	Server ServerOptions
+	// WatchInterval is how often WatchJob and health watches poll for changes (default 1s).
+	WatchInterval time.Duration
+}
+
+// GRPCServer serves JobService and grpc.health.v1 next to the HTTP API.
+type GRPCServer struct {
+	addr string
+	srv  *grpc.Server
+
+	// done is closed by Shutdown so that watch streams end and GracefulStop can finish.
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewGRPCServer returns a gRPC server sharing producer with the HTTP API.
+func NewGRPCServer(producer *queue.Producer, opts GRPCOptions) *GRPCServer {
+	if opts.WatchInterval <= 0 {
+		opts.WatchInterval = time.Second
+	}
+	s := &GRPCServer{addr: opts.Addr, done: make(chan struct{})}
+
+	// Same order as the HTTP chain: throttle by address, identify, authorize,
+	// then throttle by client.
+	var guards []grpcGuard
+	if opts.RateLimit != nil {
+		guards = append(guards, grpcRateLimit(opts.RateLimit.PreAuth()))
+	}
+	if opts.Auth != nil {
+		guards = append(guards, grpcAuth(*opts.Auth))
+	}
+	guards = append(guards, grpcRequireScope)
+	if opts.Policy != nil {
+		guards = append(guards, grpcPolicy(opts.Policy))
+	}
+	if opts.Server.Tenants != nil {
+		guards = append(guards, grpcTenantQuota(opts.Server.Tenants))
+	}
+	if opts.RateLimit != nil && !opts.RateLimit.KeysByIP() {
+		guards = append(guards, grpcRateLimit(*opts.RateLimit))
+	}
+
+	s.srv = grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(grpcRequestIDUnary, grpcObserveUnary, grpcGuardsUnary(guards)),
+		grpc.ChainStreamInterceptor(grpcRequestIDStream, grpcObserveStream, grpcGuardsStream(guards)),
+	)
+	jobsv1.RegisterJobServiceServer(s.srv, &jobService{producer: producer, opts: opts, done: s.done})
+	healthpb.RegisterHealthServer(s.srv, &healthService{checks: opts.Server.Health, interval: opts.WatchInterval, done: s.done})
+	return s
+}
+
+// ListenAndServe serves on the configured address. It returns nil once Shutdown is called.
+func (s *GRPCServer) ListenAndServe() error {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	return s.srv.Serve(lis)
+}
+
+// Shutdown ends open watch streams, stops accepting RPCs and waits for the
+// in-flight ones until ctx is done, then closes the remaining connections.
+func (s *GRPCServer) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.done) })
+
+	stopped := make(chan struct{})
+	go func() {
+		s.srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.srv.Stop()
+		return fmt.Errorf("grpc shutdown: %w", ctx.Err())
+	}
+}
+
+// jobService implements jobsv1.JobServiceServer on top of the queue producer.
+type jobService struct {
+	jobsv1.UnimplementedJobServiceServer
+
+	producer *queue.Producer
+	opts     GRPCOptions
+	done     <-chan struct{}
+}
+
+func (s *jobService) SubmitJob(ctx context.Context, req *jobsv1.SubmitJobRequest) (*jobsv1.SubmitJobResponse, error) {
+	priority, ok := priorityFromProto[req.GetPriority()]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "priority: must be one of high, normal, low")
+	}
+	if limit := s.opts.BodyLimit.limitFor(http.MethodPost, APIVersionPrefix+"/jobs"); limit > 0 && int64(proto.Size(req)) > limit {
+		return nil, status.Errorf(codes.ResourceExhausted, "request message exceeds %d bytes", limit)
+	}
+
+	principal, _ := principalFromContext(ctx)
+	if !mayUsePriority(principal, priority) {
+		return nil, status.Error(codes.PermissionDenied, "high priority requires scope "+ScopeJobsPriority)
+	}
+
+	admission := s.opts.Server.Admission
+	if !admission.Admit(priority) {
+		code := codes.ResourceExhausted
+		if admission.opts.RejectStatus == http.StatusServiceUnavailable {
+			code = codes.Unavailable
+		}
+		return nil, grpcError(code, "job queue backlog is too large, retry later", admission.opts.RetryAfter)
+	}
+
+	tenant := tenantFromContext(ctx)
+	if !s.opts.Server.Tenants.AdmitDepth(tenant) {
+		return nil, grpcError(codes.ResourceExhausted, "tenant queue depth quota exceeded", s.opts.Server.Tenants.opts.PollInterval)
+	}
+
+	job := newJob(JobRequest{Type: req.GetType(), Payload: req.GetPayload(), Priority: priority}, tenant, principal, requestIDFromContext(ctx))
+	if err := s.producer.Enqueue(ctx, job); err != nil {
+		log.Error().Err(err).Msg("Failed to enqueue job")
+		if errors.Is(err, queue.ErrSpoolFull) {
+			return nil, status.Error(codes.Unavailable, "queue unavailable and local spool full")
+		}
+		return nil, status.Error(codes.Unavailable, "job could not be enqueued")
+	}
+
+	tenantJobsTotal.WithLabelValues(queue.TenantLabel(tenant)).Inc()
+	return &jobsv1.SubmitJobResponse{JobId: job.ID, State: jobsv1.JobState_JOB_STATE_QUEUED}, nil
+}
+
+func (s *jobService) GetJob(ctx context.Context, req *jobsv1.GetJobRequest) (*jobsv1.Job, error) {
+	js, err := s.loadJob(ctx, req.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+	return jobToProto(js), nil
+}
+
+func (s *jobService) CancelJob(ctx context.Context, req *jobsv1.CancelJobRequest) (*jobsv1.Job, error) {
+	if _, err := uuid.Parse(req.GetJobId()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "job_id: must be a UUID")
+	}
+	js, err := s.producer.CancelJob(ctx, tenantFromContext(ctx), req.GetJobId())
+	switch {
+	case errors.Is(err, queue.ErrJobNotFound):
+		return nil, status.Error(codes.NotFound, "job not found")
+	case errors.Is(err, queue.ErrJobNotCancellable):
+		return nil, status.Errorf(codes.FailedPrecondition, "job is %s and can no longer be cancelled", js.Status)
+	case err != nil:
+		log.Error().Err(err).Str("job_id", req.GetJobId()).Msg("Failed to cancel job")
+		return nil, status.Error(codes.Unavailable, "job could not be cancelled")
+	}
+	return jobToProto(js), nil
+}
+
+// WatchJob polls the job's status and sends it whenever it changes, until
+// the job finishes, the client goes away or the server shuts down.
+func (s *jobService) WatchJob(req *jobsv1.WatchJobRequest, stream grpc.ServerStreamingServer[jobsv1.Job]) error {
+	ctx := stream.Context()
+	ticker := time.NewTicker(s.opts.WatchInterval)
+	defer ticker.Stop()
+
+	var last *queue.JobStatus
+	for {
+		js, err := s.loadJob(ctx, req.GetJobId())
+		if err != nil {
+			return err
+		}
+		if last == nil || js.Status != last.Status || !js.UpdatedAt.Equal(last.UpdatedAt) {
+			if err := stream.Send(jobToProto(js)); err != nil {
+				return err
+			}
+			last = js
+		}
+		if js.Finished() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-s.done:
+			return status.Error(codes.Unavailable, "server is shutting down, watch again")
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *jobService) loadJob(ctx context.Context, id string) (*queue.JobStatus, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "job_id: must be a UUID")
+	}
+	js, err := s.producer.GetJob(ctx, tenantFromContext(ctx), id)
+	if errors.Is(err, queue.ErrJobNotFound) {
+		return nil, status.Error(codes.NotFound, "job not found")
+	}
+	if err != nil {
+		log.Error().Err(err).Str("job_id", id).Msg("Failed to load job")
+		return nil, status.Error(codes.Unavailable, "job status unavailable")
+	}
+	return js, nil
+}
+
+var priorityFromProto = map[jobsv1.Priority]string{
+	jobsv1.Priority_PRIORITY_UNSPECIFIED: queue.PriorityNormal,
+	jobsv1.Priority_PRIORITY_LOW:         queue.PriorityLow,
+	jobsv1.Priority_PRIORITY_NORMAL:      queue.PriorityNormal,
+	jobsv1.Priority_PRIORITY_HIGH:        queue.PriorityHigh,
+}
+
+var priorityToProto = map[string]jobsv1.Priority{
+	queue.PriorityLow:    jobsv1.Priority_PRIORITY_LOW,
+	queue.PriorityNormal: jobsv1.Priority_PRIORITY_NORMAL,
+	queue.PriorityHigh:   jobsv1.Priority_PRIORITY_HIGH,
+}
+
+var jobStateToProto = map[string]jobsv1.JobState{
+	queue.JobQueued:    jobsv1.JobState_JOB_STATE_QUEUED,
+	queue.JobRunning:   jobsv1.JobState_JOB_STATE_RUNNING,
+	queue.JobSucceeded: jobsv1.JobState_JOB_STATE_SUCCEEDED,
+	queue.JobFailed:    jobsv1.JobState_JOB_STATE_FAILED,
+	queue.JobCancelled: jobsv1.JobState_JOB_STATE_CANCELLED,
+}
+
+func jobToProto(js *queue.JobStatus) *jobsv1.Job {
+	return &jobsv1.Job{
+		Id:         js.ID,
+		Type:       js.Type,
+		Priority:   priorityToProto[js.Priority],
+		State:      jobStateToProto[js.Status],
+		Tenant:     js.Tenant,
+		Principal:  js.Principal,
+		RequestId:  js.RequestID,
+		Error:      js.Error,
+		EnqueuedAt: timestamppb.New(js.EnqueuedAt),
+		UpdatedAt:  timestamppb.New(js.UpdatedAt),
+	}
+}
+
+// healthService implements grpc.health.v1 on top of the health registry
+// behind /ready: the overall service ("") and JobService are SERVING while
+// the API is ready and NOT_SERVING once it fails or starts draining.
+type healthService struct {
+	healthpb.UnimplementedHealthServer
+
+	checks   *health.Registry
+	interval time.Duration
+	done     <-chan struct{}
+}
+
+func (h *healthService) status(ctx context.Context, service string) healthpb.HealthCheckResponse_ServingStatus {
+	switch service {
+	case "", jobsv1.JobService_ServiceDesc.ServiceName:
+	default:
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+	if h.checks == nil || h.checks.Run(ctx).Ready() {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
+
+func (h *healthService) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	st := h.status(ctx, req.GetService())
+	if st == healthpb.HealthCheckResponse_SERVICE_UNKNOWN {
+		return nil, status.Error(codes.NotFound, "unknown service")
+	}
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+func (h *healthService) List(ctx context.Context, _ *healthpb.HealthListRequest) (*healthpb.HealthListResponse, error) {
+	st := &healthpb.HealthCheckResponse{Status: h.status(ctx, "")}
+	return &healthpb.HealthListResponse{Statuses: map[string]*healthpb.HealthCheckResponse{
+		"": st,
+		jobsv1.JobService_ServiceDesc.ServiceName: st,
+	}}, nil
+}
+
+// Watch sends the serving status on every change. On shutdown it sends
+// NOT_SERVING and ends the stream so clients move to another replica.
+func (h *healthService) Watch(req *healthpb.HealthCheckRequest, stream grpc.ServerStreamingServer[healthpb.HealthCheckResponse]) error {
+	ctx := stream.Context()
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_ServingStatus(-1)
+	for {
+		st := h.status(ctx, req.GetService())
+		if st != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return err
+			}
+			last = st
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-h.done:
+			return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING})
+		case <-ticker.C:
+		}
+	}
+}
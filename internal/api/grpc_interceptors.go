@@ -0,0 +1,336 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+	"github.com/sanjeevsethi/sre-platform-app/internal/telemetry"
+	jobsv1 "github.com/sanjeevsethi/sre-platform-app/proto/jobs/v1"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var grpcRequestDuration = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "api_grpc_request_duration_seconds",
+		Help:    "Duration of gRPC calls (streams until they end).",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"method", "code"},
+)
+
+// Context keys for values the interceptors hand to the gRPC handlers.
+type grpcContextKey int
+
+const (
+	grpcPrincipalKey grpcContextKey = iota
+	grpcRequestIDKey
+)
+
+func principalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(grpcPrincipalKey).(*Principal)
+	return p, ok
+}
+
+// tenantFromContext returns the tenant of the call's principal, or the default tenant.
+func tenantFromContext(ctx context.Context) string {
+	if p, ok := principalFromContext(ctx); ok {
+		return queue.NormalizeTenant(p.Tenant)
+	}
+	return queue.DefaultTenant
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	rid, _ := ctx.Value(grpcRequestIDKey).(string)
+	return rid
+}
+
+// metadataValue returns the first value of an incoming metadata key.
+func metadataValue(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// grpcAPIKey extracts credentials like requestAPIKey does for HTTP headers.
+func grpcAPIKey(ctx context.Context) string {
+	if key := metadataValue(ctx, APIKeyHeader); key != "" {
+		return key
+	}
+	if auth := metadataValue(ctx, "authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+// peerIP returns the caller's IP address.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// grpcError returns a status error, with a RetryInfo detail (the gRPC
+// counterpart of Retry-After) when retryAfter is positive.
+func grpcError(code codes.Code, msg string, retryAfter time.Duration) error {
+	st := status.New(code, msg)
+	if retryAfter > 0 {
+		if withRetry, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); err == nil {
+			st = withRetry
+		}
+	}
+	return st.Err()
+}
+
+// grpcGuard checks a call to a guarded RPC before its handler runs. It may
+// reject the call or return an enriched context. req is nil for streams.
+type grpcGuard func(ctx context.Context, m grpcMethod, req any) (context.Context, error)
+
+func runGuards(ctx context.Context, guards []grpcGuard, fullMethod string, req any) (context.Context, error) {
+	m, ok := grpcMethods[fullMethod]
+	if !ok {
+		return ctx, nil
+	}
+	for _, g := range guards {
+		var err error
+		if ctx, err = g(ctx, m, req); err != nil {
+			return ctx, err
+		}
+	}
+	return ctx, nil
+}
+
+func grpcGuardsUnary(guards []grpcGuard) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := runGuards(ctx, guards, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func grpcGuardsStream(guards []grpcGuard) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := runGuards(ss.Context(), guards, info.FullMethod, nil)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// contextStream replaces the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcRequestID is the gRPC counterpart of RequestIDMiddleware: it reuses the
+// caller's x-request-id or generates one, and echoes it in the response headers.
+func grpcRequestID(ctx context.Context) context.Context {
+	rid := metadataValue(ctx, RequestIDHeader)
+	if rid == "" {
+		rid = uuid.New().String()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, rid))
+	return context.WithValue(ctx, grpcRequestIDKey, rid)
+}
+
+func grpcRequestIDUnary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(grpcRequestID(ctx), req)
+}
+
+func grpcRequestIDStream(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextStream{ServerStream: ss, ctx: grpcRequestID(ss.Context())})
+}
+
+// grpcObserve records metrics and a log line per call, like MetricsMiddleware
+// and LoggerMiddleware, and turns handler panics into Internal errors.
+func grpcObserve(ctx context.Context, fullMethod string, call func(context.Context) error) (err error) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().Interface("panic", r).Str("method", fullMethod).Str("request_id", requestIDFromContext(ctx)).Msg("Recovered from panic")
+			err = status.Error(codes.Internal, "internal server error")
+		}
+
+		code := status.Code(err)
+		duration := time.Since(start)
+		telemetry.ObserveWithTrace(ctx, grpcRequestDuration.WithLabelValues(fullMethod, code.String()), duration.Seconds())
+
+		var traceID, spanID string
+		if sc := trace.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+			traceID, spanID = sc.TraceID().String(), sc.SpanID().String()
+		}
+		logger := log.Info()
+		switch code {
+		case codes.OK, codes.Canceled:
+		case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unimplemented:
+			logger = log.Error()
+		default:
+			logger = log.Warn()
+		}
+		logger.
+			Str("method", fullMethod).
+			Str("code", code.String()).
+			Dur("duration", duration).
+			Str("client_ip", peerIP(ctx)).
+			Str("request_id", requestIDFromContext(ctx)).
+			Str("trace_id", traceID).
+			Str("span_id", spanID).
+			Msg("RPC processed")
+	}()
+	return call(ctx)
+}
+
+func grpcObserveUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	err = grpcObserve(ctx, info.FullMethod, func(ctx context.Context) error {
+		var herr error
+		resp, herr = handler(ctx, req)
+		return herr
+	})
+	return resp, err
+}
+
+func grpcObserveStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return grpcObserve(ss.Context(), info.FullMethod, func(context.Context) error {
+		return handler(srv, ss)
+	})
+}
+
+// grpcAuth authenticates calls with the same credentials as AuthMiddleware.
+func grpcAuth(opts AuthOptions) grpcGuard {
+	return func(ctx context.Context, _ grpcMethod, _ any) (context.Context, error) {
+		principal, err := opts.authenticate(ctx, grpcAPIKey(ctx))
+		if err != nil {
+			if errors.Is(err, errInvalidCredentials) {
+				return ctx, status.Error(codes.Unauthenticated, "missing or invalid credentials")
+			}
+			log.Error().Err(err).Msg("API key lookup failed")
+			return ctx, status.Error(codes.Unavailable, "credentials could not be checked")
+		}
+		return context.WithValue(ctx, grpcPrincipalKey, principal), nil
+	}
+}
+
+// grpcRequireScope is the gRPC counterpart of RequireScope. gRPC has no exempt
+// methods, so with auth enabled every call reaching it has a principal.
+func grpcRequireScope(ctx context.Context, m grpcMethod, _ any) (context.Context, error) {
+	p, ok := principalFromContext(ctx)
+	if ok && !p.HasScope(m.scope) {
+		authFailuresTotal.WithLabelValues("missing_scope").Inc()
+		return ctx, status.Error(codes.PermissionDenied, "missing required scope "+m.scope)
+	}
+	return ctx, nil
+}
+
+// grpcPolicy evaluates the authorization policy against the RPC's REST equivalent.
+func grpcPolicy(policy *Policy) grpcGuard {
+	return func(ctx context.Context, m grpcMethod, req any) (context.Context, error) {
+		in := PolicyInput{Method: m.httpMethod, Route: m.route, Roles: []string{RoleAnonymous}}
+		principal, _ := principalFromContext(ctx)
+		if principal != nil {
+			in.Roles = principal.Roles
+		}
+		if submit, ok := req.(*jobsv1.SubmitJobRequest); ok {
+			in.JobType = submit.GetType()
+		}
+		if !policy.enforce(in, principal, requestIDFromContext(ctx), peerIP(ctx)) {
+			return ctx, status.Error(codes.PermissionDenied, "denied by authorization policy")
+		}
+		return ctx, nil
+	}
+}
+
+// grpcTenantQuota is the gRPC counterpart of TenantQuotaMiddleware.
+func grpcTenantQuota(q *TenantQuotas) grpcGuard {
+	return func(ctx context.Context, _ grpcMethod, _ any) (context.Context, error) {
+		if _, ok := principalFromContext(ctx); !ok {
+			return ctx, nil
+		}
+		d, err := q.allowRate(ctx, tenantFromContext(ctx))
+		if err != nil {
+			log.Error().Err(err).Msg("Tenant rate limiter error")
+			return ctx, nil
+		}
+		if !d.Allowed {
+			return ctx, grpcError(codes.ResourceExhausted, "tenant request rate quota exceeded", d.RetryAfter)
+		}
+		return ctx, nil
+	}
+}
+
+// grpcRateLimit is the gRPC counterpart of RateLimitMiddleware. An RPC uses
+// the bucket of its REST route, so a client's HTTP and gRPC calls share one budget.
+func grpcRateLimit(opts RateLimitOptions) grpcGuard {
+	limiter := opts.Limiter
+	if limiter == nil {
+		limiter = NewLocalLimiter(opts.MaxClients)
+	}
+	clientKey := grpcClientKeyFunc(opts.KeyBy)
+
+	return func(ctx context.Context, m grpcMethod, _ any) (context.Context, error) {
+		bucket, rule := opts.ruleFor(m.httpMethod, unversionedRoute(m.route))
+		d, err := limiter.Allow(ctx, bucket+"|"+clientKey(ctx), rule)
+		if err != nil {
+			log.Error().Err(err).Msg("Rate limiter error")
+			return ctx, nil
+		}
+		if !d.Allowed {
+			rateLimitRejectionsTotal.WithLabelValues(m.route).Inc()
+			return ctx, grpcError(codes.ResourceExhausted, "request rate limit exceeded for this client", d.RetryAfter)
+		}
+		return ctx, nil
+	}
+}
+
+// grpcClientKeyFunc mirrors clientKeyFunc with metadata instead of headers.
+func grpcClientKeyFunc(keyBy string) func(context.Context) string {
+	switch {
+	case keyBy == RateLimitKeyAPIKey:
+		return func(ctx context.Context) string {
+			if p, ok := principalFromContext(ctx); ok {
+				return "principal:" + p.ID
+			}
+			return "ip:" + peerIP(ctx)
+		}
+	case strings.HasPrefix(keyBy, RateLimitKeyHeaderPrefix):
+		header := strings.TrimPrefix(keyBy, RateLimitKeyHeaderPrefix)
+		return func(ctx context.Context) string {
+			if v := metadataValue(ctx, header); v != "" {
+				return "hdr:" + v
+			}
+			return "ip:" + peerIP(ctx)
+		}
+	default:
+		return func(ctx context.Context) string {
+			return "ip:" + peerIP(ctx)
+		}
+	}
+}
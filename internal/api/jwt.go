@@ -0,0 +1,389 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+)
+
+// jwksMinRefresh stops a flood of tokens with unknown key IDs from hammering the JWKS endpoint.
+const jwksMinRefresh = 30 * time.Second
+
+var jwksRefreshesTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_jwks_refreshes_total",
+		Help: "Total number of JWKS refreshes.",
+	},
+	[]string{"result"},
+)
+
+// JWKS is a cached JSON Web Key Set loaded from a URL or a file. Keys are
+// refreshed every RefreshInterval, and early when a token references an
+// unknown key ID, so signing keys can be rotated without a restart.
+type JWKS struct {
+	url             string
+	file            string
+	refreshInterval time.Duration
+	client          *http.Client
+
+	// refreshMu lets one refresh run at a time; concurrent callers wait for it
+	// and reuse its result.
+	refreshMu sync.Mutex
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// NewJWKS loads the key set from url (if set) or file and fails if it cannot.
+func NewJWKS(ctx context.Context, url, file string, refreshInterval time.Duration) (*JWKS, error) {
+	if url == "" && file == "" {
+		return nil, errors.New("jwks: a url or a file is required")
+	}
+	j := &JWKS{
+		url:             url,
+		file:            file,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: 5 * time.Second},
+	}
+	if err := j.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Key returns the public key for kid, refreshing the set when it is stale or the kid is unknown.
+func (j *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.RLock()
+	key, ok := j.keys[kid]
+	stale := j.refreshInterval > 0 && time.Since(j.fetchedAt) > j.refreshInterval
+	lastAttempt := j.lastAttempt
+	j.mu.RUnlock()
+
+	if (!ok || stale) && time.Since(lastAttempt) > jwksMinRefresh {
+		j.refreshOnce(ctx, lastAttempt)
+		j.mu.RLock()
+		key, ok = j.keys[kid]
+		j.mu.RUnlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("jwks: unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// refreshOnce refreshes the set unless another caller did since lastAttempt.
+// The fetch is detached from ctx, so a client hanging up does not abort a
+// refresh that other requests are waiting on.
+func (j *JWKS) refreshOnce(ctx context.Context, lastAttempt time.Time) {
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+	j.mu.RLock()
+	done := j.lastAttempt.After(lastAttempt)
+	j.mu.RUnlock()
+	if done {
+		return
+	}
+	if err := j.refresh(context.WithoutCancel(ctx)); err != nil {
+		// Keep serving the cached keys; the issuer may just be briefly unreachable.
+		log.Warn().Err(err).Msg("JWKS refresh failed")
+	}
+}
+
+func (j *JWKS) refresh(ctx context.Context) error {
+	j.mu.Lock()
+	j.lastAttempt = time.Now()
+	j.mu.Unlock()
+
+	data, err := j.load(ctx)
+	if err != nil {
+		jwksRefreshesTotal.WithLabelValues("error").Inc()
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		jwksRefreshesTotal.WithLabelValues("error").Inc()
+		return err
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	j.mu.Unlock()
+	jwksRefreshesTotal.WithLabelValues("success").Inc()
+	return nil
+}
+
+func (j *JWKS) load(ctx context.Context) ([]byte, error) {
+	if j.url == "" {
+		data, err := os.ReadFile(j.file)
+		if err != nil {
+			return nil, fmt.Errorf("read jwks file: %w", err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS decodes the RSA, EC and Ed25519 signing keys of a key set.
+// Keys with an unsupported type are skipped.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("parse jwks key %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("parse jwks: no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeB64Int(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeB64Int(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeB64Int(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeB64Int(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeB64Int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// JWTOptions configures bearer token verification.
+type JWTOptions struct {
+	JWKS     *JWKS
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew on exp/nbf/iat.
+	Leeway time.Duration
+	// RolesClaim is the claim holding the caller's roles; a dotted path such
+	// as "realm_access.roles" reaches into nested objects.
+	RolesClaim string
+	// RoleScopes grants scopes to roles, in addition to the token's scope claim.
+	RoleScopes map[string][]string
+	// TenantClaim is the claim naming the caller's tenant (dotted paths allowed).
+	TenantClaim string
+}
+
+// JWTVerifier validates JWTs and maps their claims to a Principal.
+type JWTVerifier struct {
+	opts   JWTOptions
+	parser *jwt.Parser
+}
+
+// NewJWTVerifier returns a verifier that checks signature, issuer, audience and
+// expiry. Issuer and Audience are required: without them a token minted by the
+// same identity provider for another service would be accepted.
+func NewJWTVerifier(opts JWTOptions) (*JWTVerifier, error) {
+	if opts.Issuer == "" || opts.Audience == "" {
+		return nil, errors.New("jwt: an issuer and an audience are required")
+	}
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(opts.Leeway),
+		jwt.WithIssuer(opts.Issuer),
+		jwt.WithAudience(opts.Audience),
+	}
+	if opts.RolesClaim == "" {
+		opts.RolesClaim = "roles"
+	}
+	if opts.TenantClaim == "" {
+		opts.TenantClaim = "tenant"
+	}
+	return &JWTVerifier{opts: opts, parser: jwt.NewParser(parserOpts...)}, nil
+}
+
+// Verify parses and validates token and returns its principal.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.opts.JWKS.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	p := &Principal{ID: sub, Method: "jwt", Roles: claimStrings(lookupClaim(claims, v.opts.RolesClaim))}
+	// OAuth2 scopes: "scope" is space separated, some issuers use an "scp" array.
+	if s, ok := claims["scope"].(string); ok {
+		p.Scopes = append(p.Scopes, strings.Fields(s)...)
+	}
+	p.Scopes = append(p.Scopes, claimStrings(claims["scp"])...)
+	for _, role := range p.Roles {
+		p.Scopes = append(p.Scopes, v.opts.RoleScopes[role]...)
+	}
+	if tenant, ok := lookupClaim(claims, v.opts.TenantClaim).(string); ok && tenant != "" {
+		if !queue.ValidTenant(tenant) {
+			return nil, fmt.Errorf("token has an invalid tenant %q", tenant)
+		}
+		p.Tenant = tenant
+	}
+	return p, nil
+}
+
+// ParseRoleScopes parses "platform-admin=admin,ci=jobs:write|jobs:read" into a role to scopes map.
+func ParseRoleScopes(spec string) (map[string][]string, error) {
+	out := make(map[string][]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		role, scopes, ok := strings.Cut(entry, "=")
+		if !ok || role == "" || scopes == "" {
+			return nil, fmt.Errorf("role scope entry %q: want role=scope|scope", entry)
+		}
+		out[strings.TrimSpace(role)] = strings.Split(scopes, "|")
+	}
+	return out, nil
+}
+
+func lookupClaim(claims jwt.MapClaims, path string) interface{} {
+	var cur interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
+
+// claimStrings accepts a string or an array of strings.
+func claimStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// looksLikeJWT distinguishes compact JWS tokens from opaque API keys.
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
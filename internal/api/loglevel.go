@@ -0,0 +1,140 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjeevsethi/sre-platform-app/internal/logger"
+)
+
+// LogLevelOptions configures the /admin/log-level endpoint.
+type LogLevelOptions struct {
+	// Sync broadcasts changes to every replica of both services; without it
+	// changes apply to this process only.
+	Sync *logger.LevelSync
+	// DefaultTTL applies when a change has no TTL; MaxTTL bounds it.
+	DefaultTTL time.Duration
+	MaxTTL     time.Duration
+}
+
+// LogLevelRequest is the body of PUT /admin/log-level.
+type LogLevelRequest struct {
+	// Module is "global" (default), "api", "worker" or "queue".
+	Module string `json:"module,omitempty"`
+	Level  string `json:"level"`
+	// TTL is a Go duration after which the level reverts, e.g. "10m".
+	TTL string `json:"ttl,omitempty"`
+}
+
+func registerLogLevelRoutes(r *gin.Engine, opts LogLevelOptions) {
+	r.GET("/admin/log-level", RequireScope(ScopeAdmin), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"levels": logger.Levels()})
+	})
+	r.PUT("/admin/log-level", RequireScope(ScopeAdmin), func(c *gin.Context) {
+		setLogLevelHandler(c, opts)
+	})
+	r.DELETE("/admin/log-level", RequireScope(ScopeAdmin), func(c *gin.Context) {
+		module := c.DefaultQuery("module", logger.Global)
+		if !validLogModule(module) {
+			validationFailed(c, "invalid log level change", FieldError{Field: "module", Message: "must be one of " + logModuleNames()})
+			return
+		}
+		changeLogLevel(c, opts, logger.LevelChange{Module: module})
+	})
+}
+
+func setLogLevelHandler(c *gin.Context, opts LogLevelOptions) {
+	var req LogLevelRequest
+	if !bindJSON(c, &req, nil) {
+		return
+	}
+	if req.Module == "" {
+		req.Module = logger.Global
+	}
+
+	var fields []FieldError
+	if !validLogModule(req.Module) {
+		fields = append(fields, FieldError{Field: "module", Message: "must be one of " + logModuleNames()})
+	}
+	if _, err := logger.ParseOverrideLevel(req.Level); err != nil {
+		fields = append(fields, FieldError{Field: "level", Message: "must be one of " + strings.Join(logger.OverrideLevels, ", ")})
+	}
+	ttl := opts.DefaultTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			fields = append(fields, FieldError{Field: "ttl", Message: "must be a positive duration such as 10m"})
+		}
+		ttl = d
+	}
+	if opts.MaxTTL > 0 && ttl > opts.MaxTTL {
+		fields = append(fields, FieldError{Field: "ttl", Message: "must be at most " + opts.MaxTTL.String()})
+	}
+	if len(fields) > 0 {
+		validationFailed(c, "invalid log level change", fields...)
+		return
+	}
+
+	changeLogLevel(c, opts, logger.LevelChange{Module: req.Module, Level: req.Level, ExpiresAt: time.Now().Add(ttl).UTC()})
+}
+
+// changeLogLevel broadcasts and applies a change, and writes it to the audit log
+// whatever the current level.
+func changeLogLevel(c *gin.Context, opts LogLevelOptions, change logger.LevelChange) {
+	from := logLevelOf(change.Module)
+	if opts.Sync != nil {
+		if err := opts.Sync.Publish(c.Request.Context(), change); err != nil {
+			log.Error().Err(err).Msg("Failed to publish log level change")
+			abortWithProblem(c, ProblemServiceUnavailable, "log level change could not be distributed")
+			return
+		}
+	}
+	// Also applied here directly, so the response reflects it without waiting for the broadcast.
+	if err := logger.Apply(change); err != nil {
+		log.Error().Err(err).Msg("Failed to apply log level change")
+		abortWithProblem(c, ProblemInternalServerError, "")
+		return
+	}
+
+	event, msg := "log_level_changed", "Log level changed"
+	if change.Level == "" {
+		event, msg = "log_level_reset", "Log level reset"
+	}
+	audit := log.Log().
+		Bool("audit", true).
+		Str("event", event).
+		Str("target_module", change.Module).
+		Str("from", from).
+		Str("to", logLevelOf(change.Module)).
+		Str("request_id", c.GetString("request_id")).
+		Str("client_ip", c.ClientIP())
+	if !change.ExpiresAt.IsZero() {
+		audit = audit.Time("expires_at", change.ExpiresAt)
+	}
+	if principal, ok := PrincipalFrom(c); ok {
+		audit = audit.Str("principal", principal.ID)
+	}
+	audit.Msg(msg)
+
+	c.JSON(http.StatusOK, gin.H{"levels": logger.Levels()})
+}
+
+func logLevelOf(module string) string {
+	for _, st := range logger.Levels() {
+		if st.Module == module {
+			return st.Level
+		}
+	}
+	return ""
+}
+
+func validLogModule(module string) bool {
+	return module == logger.Global || slices.Contains(logger.Modules, module)
+}
+
+func logModuleNames() string {
+	return strings.Join(append([]string{logger.Global}, logger.Modules...), ", ")
+}
@@ -1,7 +1,7 @@
 package api
 
 import (
-	"net/http"
+	"io"
 	"strconv"
 	"time"
 
@@ -9,13 +9,16 @@ import (
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/rs/zerolog/log"
+	"github.com/sanjeevsethi/sre-platform-app/internal/logger"
+	"github.com/sanjeevsethi/sre-platform-app/internal/telemetry"
 	"go.opentelemetry.io/otel/trace"
-	"golang.org/x/time/rate"
 )
 
 const RequestIDHeader = "X-Request-ID"
 
+// log is the api module logger; its level can be changed at runtime.
+var log = logger.Module(logger.ModuleAPI)
+
 // Metrics
 var (
 	httpRequestDuration = promauto.NewHistogramVec(
@@ -26,8 +29,42 @@ var (
 		},
 		[]string{"method", "path", "status"},
 	)
+	httpRequestsInFlight = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_http_requests_in_flight",
+			Help: "Number of HTTP requests currently being served.",
+		},
+	)
+	httpRequestSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "api_http_request_size_bytes",
+			Help:    "Size of HTTP request bodies.",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 10), // 64B .. 16MiB
+		},
+		[]string{"method", "path"},
+	)
+	httpResponseSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "api_http_response_size_bytes",
+			Help:    "Size of HTTP response bodies.",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 10), // 64B .. 16MiB
+		},
+		[]string{"method", "path", "status"},
+	)
 )
 
+// unmatchedRoute labels requests that matched no route, so scanners hitting
+// random URLs cannot blow up metric cardinality.
+const unmatchedRoute = "unmatched"
+
+// routeLabel returns the route template of the request (e.g. /workflows/:id).
+func routeLabel(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return unmatchedRoute
+}
+
 func RequestIDMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check for incoming header
@@ -49,29 +86,37 @@ func RequestIDMiddleware() gin.HandlerFunc {
 func MetricsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+		// Count what is read rather than trusting Content-Length, which chunked bodies lack.
+		body := &countingReader{ReadCloser: c.Request.Body}
+		if c.Request.Body != nil {
+			c.Request.Body = body
+		}
 
 		c.Next()
 
 		duration := time.Since(start).Seconds()
 		status := strconv.Itoa(c.Writer.Status())
-		path := c.Request.URL.Path
+		path := routeLabel(c)
 
-		httpRequestDuration.WithLabelValues(c.Request.Method, path, status).Observe(duration)
+		telemetry.ObserveWithTrace(c.Request.Context(), httpRequestDuration.WithLabelValues(c.Request.Method, path, status), duration)
+		httpRequestSize.WithLabelValues(c.Request.Method, path).Observe(float64(body.n))
+		// Size() is -1 until something has been written.
+		httpResponseSize.WithLabelValues(c.Request.Method, path, status).Observe(float64(max(c.Writer.Size(), 0)))
 	}
 }
 
-// RateLimitMiddleware creates a token bucket rate limiter.
-func RateLimitMiddleware(rps int, burst int) gin.HandlerFunc {
-	limiter := rate.NewLimiter(rate.Limit(rps), burst)
-	return func(c *gin.Context) {
-		if !limiter.Allow() {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
-				"error": "too many requests",
-			})
-			return
-		}
-		c.Next()
-	}
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
 }
 
 func LoggerMiddleware() gin.HandlerFunc {
@@ -106,6 +151,10 @@ func LoggerMiddleware() gin.HandlerFunc {
 			logger = log.Warn()
 		}
 
+		if principal, ok := PrincipalFrom(c); ok {
+			logger = logger.Str("principal", principal.ID).Str("auth_method", principal.Method)
+		}
+
 		logger.
 			Str("method", c.Request.Method).
 			Str("path", path).
@@ -0,0 +1,47 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.yaml.in/yaml/v3"
+)
+
+// The spec is written in YAML for readability and served as JSON.
+//
+//go:embed openapi.yaml
+var openAPIYAML []byte
+
+//go:embed docs.html
+var docsHTML []byte
+
+var openAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(openAPIYAML, &doc); err != nil {
+		return nil, fmt.Errorf("parse openapi.yaml: %w", err)
+	}
+	return json.Marshal(doc)
+})
+
+// OpenAPISpec returns the OpenAPI 3 document describing the routes of NewServer.
+func OpenAPISpec() ([]byte, error) {
+	return openAPIJSON()
+}
+
+func openAPIHandler(c *gin.Context) {
+	spec, err := OpenAPISpec()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to render OpenAPI spec")
+		abortWithProblem(c, ProblemInternalServerError, "")
+		return
+	}
+	c.Data(http.StatusOK, "application/json", spec)
+}
+
+func docsHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", docsHTML)
+}
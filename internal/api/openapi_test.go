@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjeevsethi/sre-platform-app/internal/health"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+)
+
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// TestOpenAPIMatchesRoutes fails when a route is registered in NewServer but
+// missing from openapi.yaml, or documented but not registered.
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	producer := queue.NewProducer("localhost:0")
+	defer producer.Close()
+	// Every optional collaborator is set so that all routes are registered.
+	r, err := NewServer(producer, ServerOptions{Health: health.NewRegistry(), LegacyRoutes: &DeprecationOptions{}, LogLevels: &LogLevelOptions{}, Pprof: true})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	registered := make(map[string]bool)
+	for _, route := range r.Routes() {
+		registered[route.Method+" "+ginParam.ReplaceAllString(route.Path, "{$1}")] = true
+	}
+
+	raw, err := OpenAPISpec()
+	if err != nil {
+		t.Fatalf("OpenAPISpec: %v", err)
+	}
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		t.Fatalf("spec is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Fatalf("openapi version = %q, want 3.x", spec.OpenAPI)
+	}
+
+	documented := make(map[string]bool)
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			if method == "parameters" {
+				continue
+			}
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	for _, route := range sortedKeys(registered) {
+		if !documented[route] {
+			t.Errorf("route %s is registered but not documented in openapi.yaml", route)
+		}
+	}
+	for _, route := range sortedKeys(documented) {
+		if !registered[route] {
+			t.Errorf("route %s is documented in openapi.yaml but not registered", route)
+		}
+	}
+}
+
+// TestOpenAPIJobRequestSchema keeps the documented JobRequest properties in
+// sync with the struct's JSON fields.
+func TestOpenAPIJobRequestSchema(t *testing.T) {
+	raw, err := OpenAPISpec()
+	if err != nil {
+		t.Fatalf("OpenAPISpec: %v", err)
+	}
+	var spec struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		t.Fatalf("spec is not valid JSON: %v", err)
+	}
+
+	var fields map[string]interface{}
+	b, _ := json.Marshal(JobRequest{Type: "t", Payload: "p", Priority: queue.PriorityNormal})
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+	props := spec.Components.Schemas["JobRequest"].Properties
+	for field := range fields {
+		if _, ok := props[field]; !ok {
+			t.Errorf("JobRequest field %q is missing from the JobRequest schema", field)
+		}
+	}
+	for prop := range props {
+		if _, ok := fields[prop]; !ok {
+			t.Errorf("JobRequest schema property %q does not exist on JobRequest", prop)
+		}
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
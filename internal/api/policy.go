@@ -0,0 +1,332 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.yaml.in/yaml/v3"
+)
+
+// Policy effects.
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+)
+
+// RoleAnonymous is the role of requests without an authenticated principal.
+const RoleAnonymous = "anonymous"
+
+// maxPolicyBodyPeek bounds how much of a request body is read to find its job type.
+const maxPolicyBodyPeek = 1 << 20
+
+var policyDecisionsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_policy_decisions_total",
+		Help: "Authorization policy decisions.",
+	},
+	[]string{"decision"},
+)
+
+// PolicyRule matches requests by method, route template, role and job type.
+// Empty lists match anything. Routes, roles and job types are glob patterns
+// ("/workflows/*", "report.*"); a route ending in "/**" matches the whole subtree.
+type PolicyRule struct {
+	Name     string   `yaml:"name" json:"name"`
+	Effect   string   `yaml:"effect" json:"effect"`
+	Methods  []string `yaml:"methods" json:"methods"`
+	Routes   []string `yaml:"routes" json:"routes"`
+	Roles    []string `yaml:"roles" json:"roles"`
+	JobTypes []string `yaml:"job_types" json:"job_types"`
+}
+
+// Policy is an ordered rule list; the first matching rule decides, otherwise Default does.
+type Policy struct {
+	Default string       `yaml:"default" json:"default"`
+	Rules   []PolicyRule `yaml:"rules" json:"rules"`
+}
+
+// PolicyInput describes the request being authorized.
+type PolicyInput struct {
+	Method  string
+	Route   string
+	Roles   []string
+	JobType string
+}
+
+// LoadPolicy reads a YAML (or JSON) policy file. Unknown keys are errors, so a
+// misspelled field cannot quietly loosen the policy.
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read policy file: %w", err)
+	}
+	var p Policy
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("parse policy file: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate checks effects and glob patterns. Default must be set explicitly.
+func (p *Policy) Validate() error {
+	if p.Default != PolicyAllow && p.Default != PolicyDeny {
+		return fmt.Errorf("policy: default must be %q or %q", PolicyAllow, PolicyDeny)
+	}
+	for i, r := range p.Rules {
+		if r.Effect != PolicyAllow && r.Effect != PolicyDeny {
+			return fmt.Errorf("policy rule %d (%s): effect must be %q or %q", i, r.Name, PolicyAllow, PolicyDeny)
+		}
+		for _, pattern := range append(append(append([]string{}, r.Routes...), r.Roles...), r.JobTypes...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("policy rule %d (%s): bad pattern %q: %w", i, r.Name, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate returns whether the request is allowed and the name of the deciding rule
+// ("default" when no rule matched).
+func (p *Policy) Evaluate(in PolicyInput) (bool, string) {
+	for i, r := range p.Rules {
+		if !r.matches(in) {
+			continue
+		}
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("rule[%d]", i)
+		}
+		return r.Effect == PolicyAllow, name
+	}
+	return p.Default == PolicyAllow, "default"
+}
+
+// usesJobTypes reports whether any rule looks at the job type.
+func (p *Policy) usesJobTypes() bool {
+	for _, r := range p.Rules {
+		if len(r.JobTypes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r PolicyRule) matches(in PolicyInput) bool {
+	if len(r.Methods) > 0 && !containsFold(r.Methods, in.Method) {
+		return false
+	}
+	if len(r.Routes) > 0 && !matchRoute(r.Routes, in.Route) {
+		return false
+	}
+	if len(r.Roles) > 0 {
+		matched := false
+		for _, role := range in.Roles {
+			if matchAny(r.Roles, role, false) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(r.JobTypes) > 0 && (in.JobType == "" || !matchAny(r.JobTypes, in.JobType, false)) {
+		return false
+	}
+	return true
+}
+
+// matchRoute matches route templates in their canonical form, so rules written
+// for /jobs or /v1/jobs cover both. Patterns whose first segment is a wildcard
+// ("/v1/**") are matched as written: unversioned, they would match every route.
+func matchRoute(patterns []string, route string) bool {
+	canonical := unversionedRoute(route)
+	for _, pattern := range patterns {
+		if matchAny([]string{pattern}, route, true) || matchAny([]string{pattern}, canonical, true) {
+			return true
+		}
+		if p := unversionedRoute(pattern); p != pattern && !strings.HasPrefix(p, "/*") && matchAny([]string{p}, canonical, true) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, value string, subtree bool) bool {
+	for _, pattern := range patterns {
+		if subtree && strings.HasSuffix(pattern, "/**") {
+			prefix := strings.TrimSuffix(pattern, "/**")
+			if value == prefix || strings.HasPrefix(value, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if v == "*" || strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyMiddleware enforces policy on every routed request after authentication.
+// Denials are answered with 403 and written to the audit log.
+func PolicyMiddleware(policy *Policy) gin.HandlerFunc {
+	peekJobType := policy.usesJobTypes()
+
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			// Unrouted requests end in 404 anyway.
+			c.Next()
+			return
+		}
+
+		in := PolicyInput{Method: c.Request.Method, Route: route, Roles: []string{RoleAnonymous}}
+		principal, authenticated := PrincipalFrom(c)
+		if authenticated {
+			in.Roles = principal.Roles
+		}
+		requestID, clientIP := c.GetString("request_id"), c.ClientIP()
+		jobTypes := []string{""}
+		if peekJobType && c.Request.Body != nil && c.Request.Method == http.MethodPost {
+			var err error
+			if jobTypes, err = requestJobTypes(c, unversionedRoute(route)); err != nil {
+				if limit, ok := tooLarge(err); ok {
+					rejectTooLarge(c, limit)
+					return
+				}
+				// Rules on job types must not fail open.
+				policy.deny(in, "undetermined_job_type", principal, requestID, clientIP)
+				abortWithProblem(c, ProblemForbidden, "job type could not be determined for authorization")
+				return
+			}
+		}
+
+		// A workflow is allowed only if every one of its step types is.
+		for _, t := range jobTypes {
+			in.JobType = t
+			if allowed, _ := policy.Evaluate(in); !allowed {
+				break
+			}
+		}
+		if !policy.enforce(in, principal, requestID, clientIP) {
+			abortWithProblem(c, ProblemForbidden, "denied by authorization policy")
+			return
+		}
+		c.Next()
+	}
+}
+
+// enforce evaluates the policy for HTTP and gRPC requests alike, counting the
+// decision and writing denials to the audit log.
+func (p *Policy) enforce(in PolicyInput, principal *Principal, requestID, clientIP string) bool {
+	allowed, rule := p.Evaluate(in)
+	if allowed {
+		policyDecisionsTotal.WithLabelValues("allow").Inc()
+		return true
+	}
+	p.deny(in, rule, principal, requestID, clientIP)
+	return false
+}
+
+// deny counts a denial and writes it to the audit log.
+func (p *Policy) deny(in PolicyInput, rule string, principal *Principal, requestID, clientIP string) {
+	policyDecisionsTotal.WithLabelValues("deny").Inc()
+	audit := log.Warn().
+		Bool("audit", true).
+		Str("event", "authorization_denied").
+		Str("rule", rule).
+		Str("method", in.Method).
+		Str("route", in.Route).
+		Strs("roles", in.Roles).
+		Str("request_id", requestID).
+		Str("client_ip", clientIP)
+	if principal != nil {
+		audit = audit.Str("principal", principal.ID)
+	}
+	if in.JobType != "" {
+		audit = audit.Str("job_type", in.JobType)
+	}
+	audit.Msg("Request denied by authorization policy")
+}
+
+// requestJobTypes reads the job types of a request body, as the route's handler
+// will see them: the "type" of a job, or the types of every workflow step.
+// Other routes carry no job type. The body is restored for the handler. It
+// fails when the body cannot be read or parsed, or is larger than maxPolicyBodyPeek.
+func requestJobTypes(c *gin.Context, route string) ([]string, error) {
+	if route != "/jobs" && route != "/workflows" {
+		return []string{""}, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPolicyBodyPeek+1))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), c.Request.Body))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPolicyBodyPeek {
+		return nil, fmt.Errorf("body exceeds %d bytes", maxPolicyBodyPeek)
+	}
+
+	if route == "/jobs" {
+		var job struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, err
+		}
+		return []string{job.Type}, nil
+	}
+
+	type step struct {
+		Type string `json:"type"`
+	}
+	var wf struct {
+		Steps  []step `json:"steps"`
+		Chain  []step `json:"chain"`
+		Groups []struct {
+			Steps    []step `json:"steps"`
+			Callback *step  `json:"callback"`
+		} `json:"groups"`
+	}
+	if err := json.Unmarshal(data, &wf); err != nil {
+		return nil, err
+	}
+	steps := append(wf.Steps, wf.Chain...)
+	for _, g := range wf.Groups {
+		steps = append(steps, g.Steps...)
+		if g.Callback != nil {
+			steps = append(steps, *g.Callback)
+		}
+	}
+	types := make([]string, 0, len(steps))
+	for _, s := range steps {
+		types = append(types, s.Type)
+	}
+	if len(types) == 0 {
+		types = append(types, "")
+	}
+	return types, nil
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ProblemContentType is the media type of RFC 7807 error responses.
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypeBase prefixes every problem type URI; the types are listed in docs/problems.md.
+const ProblemTypeBase = "urn:sre-platform:problem:"
+
+// ProblemType identifies a class of error. Clients should branch on the type URI, not on the title or detail.
+type ProblemType struct {
+	Slug   string
+	Title  string
+	Status int
+}
+
+// URI returns the problem type URI.
+func (t ProblemType) URI() string {
+	return ProblemTypeBase + t.Slug
+}
+
+// Problem types returned by the API.
+var (
+	ProblemInvalidRequest      = ProblemType{"invalid-request", "Invalid request", http.StatusBadRequest}
+	ProblemValidation          = ProblemType{"validation-failed", "Validation failed", http.StatusBadRequest}
+	ProblemUnauthorized        = ProblemType{"unauthorized", "Unauthorized", http.StatusUnauthorized}
+	ProblemForbidden           = ProblemType{"forbidden", "Forbidden", http.StatusForbidden}
+	ProblemNotFound            = ProblemType{"not-found", "Not found", http.StatusNotFound}
+	ProblemMethodNotAllowed    = ProblemType{"method-not-allowed", "Method not allowed", http.StatusMethodNotAllowed}
+	ProblemPayloadTooLarge     = ProblemType{"payload-too-large", "Payload too large", http.StatusRequestEntityTooLarge}
+	ProblemRateLimited         = ProblemType{"rate-limited", "Too many requests", http.StatusTooManyRequests}
+	ProblemTenantQuota         = ProblemType{"tenant-quota-exceeded", "Tenant quota exceeded", http.StatusTooManyRequests}
+	ProblemQueueOverloaded     = ProblemType{"queue-overloaded", "Queue overloaded", http.StatusTooManyRequests}
+	ProblemServerOverloaded    = ProblemType{"server-overloaded", "Server overloaded", http.StatusServiceUnavailable}
+	ProblemServiceUnavailable  = ProblemType{"service-unavailable", "Service unavailable", http.StatusServiceUnavailable}
+	ProblemInternalServerError = ProblemType{"internal-error", "Internal server error", http.StatusInternalServerError}
+)
+
+// FieldError points at one invalid field of the request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Extension members
+	RequestID     string       `json:"request_id,omitempty"`
+	Errors        []FieldError `json:"errors,omitempty"`
+	RequiredScope string       `json:"required_scope,omitempty"`
+}
+
+// newProblem builds a problem of type t for the current request.
+func newProblem(c *gin.Context, t ProblemType, detail string) *Problem {
+	return &Problem{
+		Type:      t.URI(),
+		Title:     t.Title,
+		Status:    t.Status,
+		Detail:    detail,
+		Instance:  c.Request.URL.Path,
+		RequestID: c.GetString("request_id"),
+	}
+}
+
+// writeProblem sends p and aborts the handler chain.
+func writeProblem(c *gin.Context, p *Problem) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Abort()
+	c.Data(p.Status, ProblemContentType, body)
+}
+
+// abortWithProblem answers the request with a problem of type t.
+func abortWithProblem(c *gin.Context, t ProblemType, detail string) {
+	writeProblem(c, newProblem(c, t, detail))
+}
+
+// bindJSON strictly decodes the request body into obj. Malformed bodies get a
+// problem response, with a field error when a field is unknown or has the wrong
+// type. When lenient is non-nil and reports true for the decoded value, unknown
+// fields are ignored instead.
+func bindJSON(c *gin.Context, obj interface{}, lenient func() bool) bool {
+	var data []byte
+	if c.Request.Body != nil {
+		var err error
+		if data, err = io.ReadAll(c.Request.Body); err != nil {
+			if limit, ok := tooLarge(err); ok {
+				rejectTooLarge(c, limit)
+				return false
+			}
+			abortWithProblem(c, ProblemInvalidRequest, "request body could not be read")
+			return false
+		}
+	}
+
+	err := decodeStrict(data, obj)
+	if field, ok := unknownField(err); ok && lenient != nil {
+		if json.Unmarshal(data, obj) == nil && lenient() {
+			return true
+		}
+		err = fmt.Errorf("json: unknown field %q", field)
+	}
+	if err == nil {
+		return true
+	}
+
+	p := newProblem(c, ProblemInvalidRequest, "request body is not valid JSON")
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch field, unknown := unknownField(err); {
+	case errors.Is(err, io.EOF):
+		p.Detail = "request body is empty"
+	case unknown:
+		p.Detail = "request body has an unknown field"
+		p.Errors = []FieldError{{Field: field, Message: "unknown field"}}
+	case errors.Is(err, errTrailingData):
+		p.Detail = "request body must hold a single JSON object"
+	case errors.As(err, &typeErr):
+		p.Detail = "request body has a field of the wrong type"
+		p.Errors = []FieldError{{Field: typeErr.Field, Message: fmt.Sprintf("must be of type %s", typeErr.Type)}}
+	case errors.As(err, &syntaxErr):
+		p.Detail = fmt.Sprintf("request body is not valid JSON (offset %d)", syntaxErr.Offset)
+	}
+	writeProblem(c, p)
+	return false
+}
+
+var errTrailingData = errors.New("trailing data after JSON value")
+
+// decodeStrict decodes a single JSON value, rejecting unknown fields.
+func decodeStrict(data []byte, obj interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(obj); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+// unknownField extracts the field name from encoding/json's unknown field
+// error, which has no dedicated type.
+func unknownField(err error) (string, bool) {
+	if err == nil {
+		return "", false
+	}
+	quoted, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !ok {
+		return "", false
+	}
+	field, uerr := strconv.Unquote(quoted)
+	if uerr != nil {
+		return quoted, true
+	}
+	return field, true
+}
+
+// validationFailed answers a well-formed request whose fields are invalid.
+func validationFailed(c *gin.Context, detail string, fields ...FieldError) {
+	p := newProblem(c, ProblemValidation, detail)
+	p.Errors = fields
+	writeProblem(c, p)
+}
+
+// RecoveryMiddleware turns a panic into a 500 problem response and logs it
+// with the stack and request context. Broken client connections are left to
+// gin, which aborts without writing.
+func RecoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered interface{}) {
+		sc := trace.SpanContextFromContext(c.Request.Context())
+		log.Error().
+			Str("panic", fmt.Sprint(recovered)).
+			Str("stack", string(debug.Stack())).
+			Str("request_id", c.GetString("request_id")).
+			Str("trace_id", sc.TraceID().String()).
+			Str("method", c.Request.Method).
+			Str("path", c.Request.URL.Path).
+			Msg("Recovered from panic")
+		abortWithProblem(c, ProblemInternalServerError, "")
+	})
+}
+
+// noRouteHandler and noMethodHandler replace gin's plain-text 404 and 405.
+func noRouteHandler(c *gin.Context) {
+	abortWithProblem(c, ProblemNotFound, "no route matches "+c.Request.URL.Path)
+}
+
+func noMethodHandler(c *gin.Context) {
+	abortWithProblem(c, ProblemMethodNotAllowed, c.Request.Method+" is not supported on "+c.Request.URL.Path)
+}
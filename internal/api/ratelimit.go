@@ -0,0 +1,346 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+// Client key strategies for RateLimitOptions.KeyBy.
+const (
+	RateLimitKeyIP     = "ip"
+	RateLimitKeyAPIKey = "api_key"
+	// RateLimitKeyHeaderPrefix selects a custom header, e.g. "header:X-Client-ID".
+	RateLimitKeyHeaderPrefix = "header:"
+)
+
+// APIKeyHeader carries API keys when they are not sent as a bearer token.
+const APIKeyHeader = "X-API-Key"
+
+var rateLimitRejectionsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_rate_limit_rejections_total",
+		Help: "Total number of requests rejected by the rate limiter.",
+	},
+	[]string{"route"},
+)
+
+// RateLimitRule is a token bucket: RPS tokens per second with the given burst.
+type RateLimitRule struct {
+	RPS   float64
+	Burst int
+}
+
+// Validate rejects rules that could never admit a request; the GCRA script
+// cannot compute an emission interval without a positive rate either.
+func (r RateLimitRule) Validate() error {
+	if r.RPS <= 0 || math.IsInf(r.RPS, 0) || math.IsNaN(r.RPS) {
+		return fmt.Errorf("rps must be positive, got %v", r.RPS)
+	}
+	if r.Burst < 1 {
+		return fmt.Errorf("burst must be at least 1, got %d", r.Burst)
+	}
+	return nil
+}
+
+// RateLimitOptions configures RateLimitMiddleware.
+type RateLimitOptions struct {
+	// Default applies to every route without a specific rule.
+	Default RateLimitRule
+	// Routes maps "METHOD /route/template" (or just "/route/template") to a rule.
+	Routes map[string]RateLimitRule
+	// KeyBy selects how clients are identified: "ip", "api_key" (the
+	// authenticated principal) or "header:<Name>".
+	KeyBy string
+	// ExemptPaths are never rate limited (probes, metrics).
+	ExemptPaths []string
+	// MaxClients bounds the number of tracked limiters; the least recently used are evicted.
+	MaxClients int
+	// Limiter stores the buckets. Defaults to an in-memory limiter; use a
+	// RedisLimiter to share limits across replicas.
+	Limiter Limiter
+
+	// perAddress puts all routes of a client into one bucket under Default.
+	perAddress bool
+}
+
+// PreAuth returns the options of the limiter that runs before authentication,
+// so that requests with bad credentials are throttled too. It keys by client
+// IP: with KeyBy "ip" it is the whole limiter; otherwise it caps each address
+// at the Default rule across all routes, and a limiter with these options runs
+// after authentication.
+func (o RateLimitOptions) PreAuth() RateLimitOptions {
+	if o.KeysByIP() {
+		return o
+	}
+	o.KeyBy = RateLimitKeyIP
+	o.perAddress = true
+	return o
+}
+
+// KeysByIP reports whether clients are identified by IP alone, in which case
+// the PreAuth limiter is the only one needed.
+func (o RateLimitOptions) KeysByIP() bool {
+	return o.KeyBy == "" || o.KeyBy == RateLimitKeyIP
+}
+
+// ParseRouteLimits parses "POST /jobs=10:20,/workflows/:id=50:100" into per-route rules.
+func ParseRouteLimits(spec string) (map[string]RateLimitRule, error) {
+	rules := make(map[string]RateLimitRule)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, limit, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("rate limit entry %q: want route=rps:burst", entry)
+		}
+		rpsStr, burstStr, ok := strings.Cut(limit, ":")
+		if !ok {
+			return nil, fmt.Errorf("rate limit entry %q: want route=rps:burst", entry)
+		}
+		rps, err := strconv.ParseFloat(rpsStr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit entry %q: invalid rps: %w", entry, err)
+		}
+		burst, err := strconv.Atoi(burstStr)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit entry %q: invalid burst: %w", entry, err)
+		}
+		rule := RateLimitRule{RPS: rps, Burst: burst}
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("rate limit entry %q: %w", entry, err)
+		}
+		rules[routeKey(route)] = rule
+	}
+	return rules, nil
+}
+
+// RateLimitMiddleware applies a token bucket per client and per route.
+func RateLimitMiddleware(opts RateLimitOptions) gin.HandlerFunc {
+	exempt := make(map[string]bool, len(opts.ExemptPaths))
+	for _, p := range opts.ExemptPaths {
+		if p = strings.TrimSpace(p); p != "" {
+			exempt[p] = true
+		}
+	}
+	limiter := opts.Limiter
+	if limiter == nil {
+		limiter = NewLocalLimiter(opts.MaxClients)
+	}
+	clientKey := clientKeyFunc(opts.KeyBy)
+
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if exempt[route] || exempt[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+
+		// Aliases share their versioned route's bucket
+		bucket, rule := opts.ruleFor(c.Request.Method, unversionedRoute(route))
+		d, err := limiter.Allow(c.Request.Context(), bucket+"|"+clientKey(c), rule)
+		if err != nil {
+			// Fail open: a broken limiter must not take the API down.
+			log.Error().Err(err).Msg("Rate limiter error")
+			c.Next()
+			return
+		}
+
+		setRateLimitHeaders(c, rule, d)
+		if !d.Allowed {
+			rateLimitRejectionsTotal.WithLabelValues(routeLabel(c)).Inc()
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(d.RetryAfter)))
+			abortWithProblem(c, ProblemRateLimited, "request rate limit exceeded for this client")
+			return
+		}
+		c.Next()
+	}
+}
+
+// setRateLimitHeaders writes the IETF draft RateLimit-* headers
+// (draft-ietf-httpapi-ratelimit-headers). The policy window is the time the
+// bucket takes to refill from empty.
+func setRateLimitHeaders(c *gin.Context, rule RateLimitRule, d RateLimitDecision) {
+	c.Header("RateLimit-Limit", strconv.Itoa(d.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.ResetAfter)))
+	if rule.RPS > 0 {
+		window := int(math.Ceil(float64(rule.Burst) / rule.RPS))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rule.Burst, window))
+	}
+}
+
+// ceilSeconds rounds a duration up to whole seconds, as HTTP delta-seconds require.
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ruleFor returns the most specific rule for a request and the bucket key for
+// the route. Every route gets its own bucket per client, so traffic to one
+// endpoint does not use up the budget of another.
+func (o RateLimitOptions) ruleFor(method, route string) (string, RateLimitRule) {
+	if o.perAddress {
+		return "address", o.Default
+	}
+	if route == "" {
+		return unmatchedRoute, o.Default
+	}
+	bucket := method + " " + route
+	if rule, ok := o.Routes[bucket]; ok {
+		return bucket, rule
+	}
+	if rule, ok := o.Routes[route]; ok {
+		return bucket, rule
+	}
+	return bucket, o.Default
+}
+
+// clientKeyFunc returns the function identifying the client of a request.
+// Requests without the selected identity fall back to the client IP. With
+// "api_key" the key is the principal AuthMiddleware verified, never the raw
+// credential: rotating made-up keys must not buy fresh buckets.
+func clientKeyFunc(keyBy string) func(*gin.Context) string {
+	switch {
+	case keyBy == RateLimitKeyAPIKey:
+		return func(c *gin.Context) string {
+			if p, ok := PrincipalFrom(c); ok {
+				return "principal:" + p.ID
+			}
+			return "ip:" + c.ClientIP()
+		}
+	case strings.HasPrefix(keyBy, RateLimitKeyHeaderPrefix):
+		header := strings.TrimPrefix(keyBy, RateLimitKeyHeaderPrefix)
+		return func(c *gin.Context) string {
+			if v := c.GetHeader(header); v != "" {
+				return "hdr:" + v
+			}
+			return "ip:" + c.ClientIP()
+		}
+	default:
+		return func(c *gin.Context) string {
+			return "ip:" + c.ClientIP()
+		}
+	}
+}
+
+// requestAPIKey extracts an API key from X-API-Key or an Authorization bearer token.
+func requestAPIKey(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+// RateLimitDecision is the outcome of a limiter check plus the quota state
+// needed for the RateLimit-* response headers.
+type RateLimitDecision struct {
+	Allowed bool
+	// Limit is the bucket capacity (burst).
+	Limit int
+	// Remaining is the number of requests that may still be made immediately.
+	Remaining int
+	// ResetAfter is the time until the bucket is full again.
+	ResetAfter time.Duration
+	// RetryAfter is the time until the next request would be allowed (denials only).
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether the request identified by key may proceed under rule.
+type Limiter interface {
+	Allow(ctx context.Context, key string, rule RateLimitRule) (RateLimitDecision, error)
+}
+
+// localLimiter keeps token buckets in process memory.
+type localLimiter struct {
+	store *limiterStore
+}
+
+// NewLocalLimiter returns an in-memory limiter tracking at most maxClients buckets.
+func NewLocalLimiter(maxClients int) Limiter {
+	return &localLimiter{store: newLimiterStore(maxClients)}
+}
+
+func (l *localLimiter) Allow(_ context.Context, key string, rule RateLimitRule) (RateLimitDecision, error) {
+	lim := l.store.get(key, rule)
+	now := time.Now()
+	d := RateLimitDecision{Limit: rule.Burst}
+
+	// Reserve a token and give it back if we would have to wait for it; the
+	// reservation's delay is exactly the Retry-After the client needs.
+	r := lim.ReserveN(now, 1)
+	if !r.OK() {
+		return d, nil
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		d.RetryAfter = delay
+	} else {
+		d.Allowed = true
+	}
+
+	tokens := lim.TokensAt(now)
+	if tokens > 0 {
+		d.Remaining = int(tokens)
+	}
+	if rule.RPS > 0 {
+		d.ResetAfter = time.Duration((float64(rule.Burst) - tokens) / rule.RPS * float64(time.Second))
+	}
+	return d, nil
+}
+
+// limiterStore is an LRU cache of token buckets so idle clients do not leak memory.
+type limiterStore struct {
+	mu    sync.Mutex
+	max   int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type limiterEntry struct {
+	key     string
+	limiter *rate.Limiter
+}
+
+func newLimiterStore(max int) *limiterStore {
+	if max <= 0 {
+		max = 10000
+	}
+	return &limiterStore{max: max, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (s *limiterStore) get(key string, rule RateLimitRule) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.ll.MoveToFront(el)
+		return el.Value.(*limiterEntry).limiter
+	}
+
+	l := rate.NewLimiter(rate.Limit(rule.RPS), rule.Burst)
+	s.items[key] = s.ll.PushFront(&limiterEntry{key: key, limiter: l})
+	if s.ll.Len() > s.max {
+		oldest := s.ll.Back()
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(*limiterEntry).key)
+	}
+	return l
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/extra/redisotel/v8"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sony/gobreaker"
+)
+
+// redisLimiterTimeout bounds how long a request waits on Redis before falling back.
+const redisLimiterTimeout = 50 * time.Millisecond
+
+var rateLimitFallbackTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "api_rate_limit_fallback_total",
+		Help: "Total number of rate limit decisions made by the local limiter because Redis was unavailable.",
+	},
+)
+
+// gcraScript implements the Generic Cell Rate Algorithm atomically in Redis.
+// It stores only the theoretical arrival time (TAT) per key and uses the Redis
+// clock so every API replica shares one view of time.
+//
+// KEYS[1] = bucket key
+// ARGV[1] = emission interval in ms (1000 / rps)
+// ARGV[2] = burst
+// Returns {allowed, remaining, retry_after_ms, reset_after_ms}.
+var gcraScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local tolerance = interval * burst
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if not tat or tat < now then
+  tat = now
+end
+
+local new_tat = tat + interval
+local allow_at = new_tat - tolerance
+if allow_at > now then
+  return {0, 0, math.ceil(allow_at - now), math.ceil(tat - now)}
+end
+
+redis.call('SET', KEYS[1], string.format('%.3f', new_tat), 'PX', math.ceil(new_tat - now))
+local remaining = math.floor((tolerance - (new_tat - now)) / interval)
+return {1, remaining, 0, math.ceil(new_tat - now)}
+`)
+
+// RedisLimiter shares GCRA buckets across all API replicas through Redis.
+// If Redis errors (or its circuit breaker is open) the decision is delegated
+// to the local fallback limiter, so the API keeps limiting per replica.
+type RedisLimiter struct {
+	client   *redis.Client
+	cb       *gobreaker.CircuitBreaker
+	fallback Limiter
+}
+
+// NewRedisLimiter connects to Redis at addr and falls back to fallback on errors.
+func NewRedisLimiter(addr string, fallback Limiter) *RedisLimiter {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	// Enable tracing
+	rdb.AddHook(redisotel.NewTracingHook())
+
+	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:        "RedisRateLimiter",
+		MaxRequests: 5,
+		Interval:    10 * time.Second,
+		Timeout:     10 * time.Second,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= 5
+		},
+	})
+
+	return &RedisLimiter{client: rdb, cb: cb, fallback: fallback}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, rule RateLimitRule) (RateLimitDecision, error) {
+	if err := rule.Validate(); err != nil {
+		return RateLimitDecision{}, fmt.Errorf("rate limit rule: %w", err)
+	}
+	res, err := l.cb.Execute(func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, redisLimiterTimeout)
+		defer cancel()
+		return gcraScript.Run(ctx, l.client, []string{"ratelimit:" + key}, 1000/rule.RPS, rule.Burst).Int64Slice()
+	})
+	if err != nil {
+		rateLimitFallbackTotal.Inc()
+		log.Debug().Err(err).Msg("Redis rate limiter unavailable, using local limiter")
+		return l.fallback.Allow(ctx, key, rule)
+	}
+
+	vals := res.([]int64)
+	if len(vals) != 4 {
+		return RateLimitDecision{}, fmt.Errorf("unexpected GCRA reply: %v", vals)
+	}
+	return RateLimitDecision{
+		Allowed:    vals[0] == 1,
+		Limit:      rule.Burst,
+		Remaining:  int(vals[1]),
+		RetryAfter: time.Duration(vals[2]) * time.Millisecond,
+		ResetAfter: time.Duration(vals[3]) * time.Millisecond,
+	}, nil
+}
+
+// Close releases the Redis connection pool.
+func (l *RedisLimiter) Close() error {
+	return l.client.Close()
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+)
+
+// TestClientKeyIgnoresSpoofedForwardedFor checks that a client cannot pick its
+// rate limit bucket through X-Forwarded-For unless it is a trusted proxy.
+func TestClientKeyIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	producer := queue.NewProducer("localhost:0")
+	defer producer.Close()
+
+	tests := []struct {
+		name    string
+		trusted []string
+		xff     string
+		want    string
+	}{
+		{name: "no header", want: "ip:203.0.113.7"},
+		{name: "spoofed, no trusted proxies", xff: "198.51.100.1", want: "ip:203.0.113.7"},
+		{name: "spoofed, peer not trusted", trusted: []string{"10.0.0.0/8"}, xff: "198.51.100.1", want: "ip:203.0.113.7"},
+		{name: "set by trusted proxy", trusted: []string{"203.0.113.0/24"}, xff: "198.51.100.1", want: "ip:198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			key := clientKeyFunc(RateLimitKeyIP)
+			r, err := NewServer(producer, ServerOptions{TrustedProxies: tt.trusted}, func(c *gin.Context) {
+				got = key(c)
+				c.Next()
+			})
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+			req.RemoteAddr = "203.0.113.7:40000"
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("client key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
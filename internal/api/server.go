@@ -1,24 +1,61 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
-	"runtime"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/rs/zerolog/log"
+	"github.com/sanjeevsethi/sre-platform-app/internal/diagnostics"
+	"github.com/sanjeevsethi/sre-platform-app/internal/health"
 	"github.com/sanjeevsethi/sre-platform-app/internal/metadata"
 	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+	"github.com/sanjeevsethi/sre-platform-app/internal/telemetry"
 )
 
-// NewServer returns a new Gin Engine with all routes registered.
-func NewServer(producer *queue.Producer, middlewares ...gin.HandlerFunc) *gin.Engine {
+// ServerOptions carries optional collaborators for the router.
+// A nil field disables the corresponding feature.
+type ServerOptions struct {
+	// Admission sheds low-priority jobs while the queue backlog is too large.
+	Admission *AdmissionController
+	// Tenants enforces per-tenant queue-depth quotas.
+	Tenants *TenantQuotas
+	// Health backs /ready and /health; without it the service is always ready.
+	Health *health.Registry
+	// LegacyRoutes keeps the business endpoints at their unversioned paths as
+	// deprecated aliases of the /v1 routes.
+	LegacyRoutes *DeprecationOptions
+	// LenientJobTypes lists job types whose requests may carry unknown fields;
+	// all other bodies are decoded strictly.
+	LenientJobTypes map[string]bool
+	// WorkflowLimits bounds the steps and dependencies of submitted workflows.
+	WorkflowLimits WorkflowLimits
+	// LogLevels serves /admin/log-level to change log levels at runtime.
+	LogLevels *LogLevelOptions
+	// Pprof serves the net/http/pprof profiles under /debug/pprof/ (scope admin).
+	Pprof bool
+	// TrustedProxies lists the addresses or CIDRs whose X-Forwarded-For and
+	// X-Real-IP headers are believed. Empty trusts none, so clients cannot pick
+	// the IP they are rate limited and logged by.
+	TrustedProxies []string
+}
+
+// NewServer returns a new Gin Engine with all routes registered. It fails on
+// an invalid trusted proxy.
+func NewServer(producer *queue.Producer, opts ServerOptions, middlewares ...gin.HandlerFunc) (*gin.Engine, error) {
 	r := gin.New() // Use New() to avoid default Logger/Recovery if we adding our own, or we can add them manually.
 	// But sticking to Default() + our own is fine, though double logging might happen if we use ours.
 	// The user wanted SRE logs (JSON). Gin default logs to stdout (text).
 	// Let's use New() and add Recovery manually. Our logger middleware replaces the default Logger.
-	r.Use(gin.Recovery())
+	// Recovery answers panics with a problem+json 500 and logs them as JSON.
+	r.Use(RecoveryMiddleware())
+	if err := r.SetTrustedProxies(opts.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(noRouteHandler)
+	r.NoMethod(noMethodHandler)
 
 	// Add passed middlewares
 	for _, m := range middlewares {
@@ -27,18 +64,49 @@ func NewServer(producer *queue.Producer, middlewares ...gin.HandlerFunc) *gin.En
 
 	r.GET("/", rootHandler)
 	r.GET("/healthz", healthzHandler)
-	r.GET("/ready", readyHandler)
+	if opts.Health != nil {
+		r.GET("/ready", gin.WrapH(opts.Health.ReadyHandler()))
+		r.GET("/health", RequireScope(ScopeAdmin), gin.WrapH(opts.Health.DetailsHandler()))
+	} else {
+		r.GET("/ready", readyHandler)
+	}
 	r.GET("/version", versionHandler)
-	r.GET("/debug/info", debugInfoHandler)
-	// Exposing the /metrics endpoint using the promhttp handler wrapped in gin
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/debug/info", RequireScope(ScopeAdmin), debugInfoHandler)
+	if opts.Pprof {
+		r.GET("/debug/pprof/*profile", RequireScope(ScopeAdmin), gin.WrapH(diagnostics.PprofHandler()))
+	}
+	if opts.LogLevels != nil {
+		registerLogLevelRoutes(r, *opts.LogLevels)
+	}
+	// Exposing the /metrics endpoint (OpenMetrics when negotiated, for exemplars)
+	r.GET("/metrics", gin.WrapH(telemetry.MetricsHandler()))
+	// API description (keep openapi.yaml in sync with the routes registered here)
+	r.GET("/openapi.json", openAPIHandler)
+	r.GET("/docs", docsHandler)
+
+	// Business endpoints are versioned; operational ones above stay at the root.
+	registerJobRoutes(r.Group(APIVersionPrefix), producer, opts)
+	if opts.LegacyRoutes != nil {
+		registerJobRoutes(r.Group("", deprecatedRoute(*opts.LegacyRoutes)), producer, opts)
+	}
+
+	return r, nil
+}
 
+// registerJobRoutes mounts the job and workflow endpoints on g.
+func registerJobRoutes(g *gin.RouterGroup, producer *queue.Producer, opts ServerOptions) {
 	// Jobs endpoint
-	r.POST("/jobs", func(c *gin.Context) {
-		jobHandler(c, producer)
+	g.POST("/jobs", RequireScope(ScopeJobsWrite), func(c *gin.Context) {
+		jobHandler(c, producer, opts)
 	})
 
-	return r
+	// Workflow endpoints
+	g.POST("/workflows", RequireScope(ScopeJobsWrite), func(c *gin.Context) {
+		workflowSubmitHandler(c, producer, opts)
+	})
+	g.GET("/workflows/:id", RequireScope(ScopeJobsRead), func(c *gin.Context) {
+		workflowStatusHandler(c, producer)
+	})
 }
 
 // Creating handler for /healthz (Liveness)
@@ -46,9 +114,8 @@ func healthzHandler(c *gin.Context) {
 	c.String(http.StatusOK, "ok")
 }
 
-// Creating handler for /ready (Readiness)
+// Creating handler for /ready (Readiness) when no health checks are registered
 func readyHandler(c *gin.Context) {
-	// Future: Check DB/Redis connections here.
 	c.String(http.StatusOK, "ready")
 }
 
@@ -57,18 +124,9 @@ func versionHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, metadata.GetBuildInfo())
 }
 
-// Debug Info Handler
+// Debug Info Handler (runtime, GC and build details)
 func debugInfoHandler(c *gin.Context) {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	c.JSON(http.StatusOK, gin.H{
-		"goroutines":         runtime.NumGoroutine(),
-		"memory_alloc":       m.Alloc,
-		"memory_total_alloc": m.TotalAlloc,
-		"memory_sys":         m.Sys,
-		"num_gc":             m.NumGC,
-	})
+	c.JSON(http.StatusOK, diagnostics.Snapshot())
 }
 
 func rootHandler(c *gin.Context) {
@@ -76,34 +134,88 @@ func rootHandler(c *gin.Context) {
 }
 
 type JobRequest struct {
+	// Type names the kind of work; authorization policies can match on it.
+	Type    string `json:"type,omitempty"`
 	Payload string `json:"payload"`
+	// Priority is "high", "normal" (default) or "low"; low-priority jobs are shed first under load.
+	Priority string `json:"priority,omitempty"`
 }
 
-func jobHandler(c *gin.Context, p *queue.Producer) {
+func jobHandler(c *gin.Context, p *queue.Producer, opts ServerOptions) {
 	var req JobRequest
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+	if !bindJSON(c, &req, func() bool { return opts.LenientJobTypes[req.Type] }) {
 		return
 	}
 
-	rid := c.GetString("request_id")
-	if rid == "" {
-		rid = "unknown"
+	switch req.Priority {
+	case "":
+		req.Priority = queue.PriorityNormal
+	case queue.PriorityLow, queue.PriorityNormal, queue.PriorityHigh:
+	default:
+		validationFailed(c, "invalid job", FieldError{Field: "priority", Message: "must be one of high, normal, low"})
+		return
+	}
+	principal, _ := PrincipalFrom(c)
+	if !mayUsePriority(principal, req.Priority) {
+		p := newProblem(c, ProblemForbidden, "high priority requires scope "+ScopeJobsPriority)
+		p.RequiredScope = ScopeJobsPriority
+		writeProblem(c, p)
+		return
 	}
 
-	job := queue.Job{
-		ID:        uuid.New().String(),
-		Payload:   req.Payload,
-		RequestID: rid,
+	// Backpressure: refuse work early instead of letting the backlog grow unbounded.
+	admission := opts.Admission
+	if !admission.Admit(req.Priority) {
+		admission.reject(c)
+		return
+	}
+
+	tenant := tenantOf(c)
+	if !opts.Tenants.AdmitDepth(tenant) {
+		opts.Tenants.rejectDepth(c)
+		return
 	}
 
+	job := newJob(req, tenant, principal, c.GetString("request_id"))
+
 	ctx := c.Request.Context()
 	if err := p.Enqueue(ctx, job); err != nil {
 		// Circuit breaker error or Redis error
 		log.Error().Err(err).Msg("Failed to enqueue job")
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "service unavailable"})
+		if errors.Is(err, queue.ErrSpoolFull) {
+			abortWithProblem(c, ProblemServiceUnavailable, "queue unavailable and local spool full")
+			return
+		}
+		abortWithProblem(c, ProblemServiceUnavailable, "job could not be enqueued")
 		return
 	}
 
+	tenantJobsTotal.WithLabelValues(queue.TenantLabel(tenant)).Inc()
 	c.JSON(http.StatusAccepted, gin.H{"status": "queued", "job_id": job.ID})
 }
+
+// mayUsePriority reports whether principal may submit a job of priority.
+// High priority is never shed, so it needs ScopeJobsPriority; a nil principal
+// only reaches the handlers with auth disabled.
+func mayUsePriority(principal *Principal, priority string) bool {
+	return priority != queue.PriorityHigh || principal == nil || principal.HasScope(ScopeJobsPriority)
+}
+
+// newJob builds the queue job for a validated request, over HTTP or gRPC.
+func newJob(req JobRequest, tenant string, principal *Principal, requestID string) queue.Job {
+	if requestID == "" {
+		requestID = "unknown"
+	}
+	job := queue.Job{
+		ID:        uuid.New().String(),
+		Type:      req.Type,
+		Payload:   req.Payload,
+		RequestID: requestID,
+		Priority:  req.Priority,
+		Tenant:    tenant,
+	}
+	if principal != nil {
+		job.Principal = principal.ID
+	}
+	return job
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sanjeevsethi/sre-platform-app/internal/health"
+)
+
+// Graceful shutdown phases, in order.
+const (
+	PhaseNotReady      = "not_ready"
+	PhaseDrainDelay    = "drain_delay"
+	PhaseStopAccepting = "stop_accepting"
+	PhaseWaitInFlight  = "wait_in_flight"
+)
+
+// Shutdown metrics
+var (
+	shutdownPhase = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_shutdown_phase",
+			Help: "Graceful shutdown phase in progress (1 = active).",
+		},
+		[]string{"phase"},
+	)
+	shutdownPhaseDuration = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_shutdown_phase_duration_seconds",
+			Help: "How long each completed graceful shutdown phase took.",
+		},
+		[]string{"phase"},
+	)
+	shutdownForcedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "api_shutdown_forced_total",
+			Help: "Shutdowns that closed connections with requests still in flight.",
+		},
+	)
+)
+
+// ShutdownOptions configures Shutdown.
+type ShutdownOptions struct {
+	// Health is flipped to draining so /ready fails; nil skips that phase.
+	Health *health.Registry
+	// DrainDelay keeps serving after /ready fails, giving the load balancer and
+	// Kubernetes endpoints time to stop routing to this pod.
+	DrainDelay time.Duration
+	// Timeout bounds the wait for in-flight requests.
+	Timeout time.Duration
+}
+
+// Shutdown stops srv without dropping requests: it fails readiness, waits
+// out the drain delay, stops accepting connections and then waits for
+// in-flight requests. If they do not finish within the timeout the remaining
+// connections are closed and the error is returned.
+func Shutdown(srv *http.Server, opts ShutdownOptions) error {
+	phase := func(name string, fn func() error) error {
+		log.Info().Str("phase", name).Msg("Shutdown phase started")
+		shutdownPhase.WithLabelValues(name).Set(1)
+		start := time.Now()
+		err := fn()
+		elapsed := time.Since(start)
+		shutdownPhase.WithLabelValues(name).Set(0)
+		shutdownPhaseDuration.WithLabelValues(name).Set(elapsed.Seconds())
+		log.Info().Str("phase", name).Dur("duration", elapsed).Err(err).Msg("Shutdown phase finished")
+		return err
+	}
+
+	// 1. Fail /ready
+	phase(PhaseNotReady, func() error {
+		if opts.Health != nil {
+			opts.Health.SetDraining()
+		}
+		return nil
+	})
+
+	// 2. Keep serving while endpoints converge
+	phase(PhaseDrainDelay, func() error {
+		time.Sleep(opts.DrainDelay)
+		return nil
+	})
+
+	// 3. Close the listeners; Shutdown does that first, then waits for
+	// active connections to go idle.
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	phase(PhaseStopAccepting, func() error {
+		srv.SetKeepAlivesEnabled(false)
+		go func() { done <- srv.Shutdown(ctx) }()
+		return nil
+	})
+
+	// 4. Wait for in-flight requests
+	return phase(PhaseWaitInFlight, func() error {
+		err := <-done
+		if err != nil {
+			shutdownForcedTotal.Inc()
+			log.Error().Err(err).Dur("timeout", opts.Timeout).Msg("In-flight requests did not finish, closing connections")
+			if closeErr := srv.Close(); closeErr != nil {
+				log.Error().Err(closeErr).Msg("Could not close http server")
+			}
+		}
+		return err
+	})
+}
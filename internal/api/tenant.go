@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+)
+
+// Tenant metrics. The tenant label is bounded by queue.TenantLabel.
+var (
+	tenantRejectionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_tenant_quota_rejections_total",
+			Help: "Requests rejected because a tenant exceeded its quota.",
+		},
+		[]string{"tenant", "reason"},
+	)
+	tenantJobsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_tenant_jobs_enqueued_total",
+			Help: "Jobs enqueued per tenant.",
+		},
+		[]string{"tenant"},
+	)
+	tenantQueueDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_tenant_queue_depth",
+			Help: "Queue depth per tenant last observed by the quota poller.",
+		},
+		[]string{"tenant"},
+	)
+)
+
+// tenantOf returns the tenant of the request's principal, or the default tenant.
+func tenantOf(c *gin.Context) string {
+	if p, ok := PrincipalFrom(c); ok {
+		return queue.NormalizeTenant(p.Tenant)
+	}
+	return queue.DefaultTenant
+}
+
+// TenantQuota limits one tenant. Zero values mean unlimited.
+type TenantQuota struct {
+	RPS      float64
+	Burst    int
+	MaxDepth int64
+}
+
+// ParseTenantQuota parses "rps:burst:max_depth", e.g. "50:100:10000".
+func ParseTenantQuota(spec string) (TenantQuota, error) {
+	var q TenantQuota
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return q, nil
+	}
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 {
+		return q, fmt.Errorf("tenant quota %q: want rps:burst:max_depth", spec)
+	}
+	var err error
+	if q.RPS, err = strconv.ParseFloat(parts[0], 64); err != nil {
+		return q, fmt.Errorf("tenant quota %q: invalid rps: %w", spec, err)
+	}
+	if q.Burst, err = strconv.Atoi(parts[1]); err != nil {
+		return q, fmt.Errorf("tenant quota %q: invalid burst: %w", spec, err)
+	}
+	if q.MaxDepth, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+		return q, fmt.Errorf("tenant quota %q: invalid max_depth: %w", spec, err)
+	}
+	// A zero rps leaves the rate unlimited; anything else must be a usable bucket.
+	if q.RPS != 0 {
+		if err := (RateLimitRule{RPS: q.RPS, Burst: q.Burst}).Validate(); err != nil {
+			return q, fmt.Errorf("tenant quota %q: %w", spec, err)
+		}
+	}
+	if q.MaxDepth < 0 {
+		return q, fmt.Errorf("tenant quota %q: max_depth must not be negative, got %d", spec, q.MaxDepth)
+	}
+	return q, nil
+}
+
+// ParseTenantQuotas parses "team-a=50:100:10000,team-b=5:10:1000".
+func ParseTenantQuotas(spec string) (map[string]TenantQuota, error) {
+	out := make(map[string]TenantQuota)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		tenant, quota, ok := strings.Cut(entry, "=")
+		if !ok || !queue.ValidTenant(tenant) {
+			return nil, fmt.Errorf("tenant quota entry %q: want tenant=rps:burst:max_depth", entry)
+		}
+		q, err := ParseTenantQuota(quota)
+		if err != nil {
+			return nil, err
+		}
+		out[tenant] = q
+	}
+	return out, nil
+}
+
+// TenantQuotaOptions configures per-tenant quotas.
+type TenantQuotaOptions struct {
+	// Default applies to tenants without an entry in Tenants.
+	Default TenantQuota
+	Tenants map[string]TenantQuota
+	// Limiter stores the per-tenant token buckets (shared with the rate limiter).
+	Limiter      Limiter
+	PollInterval time.Duration
+}
+
+// TenantQuotas enforces each tenant's request rate and queue depth. Depths are
+// polled in the background, like admission control, so enqueues stay cheap.
+type TenantQuotas struct {
+	opts TenantQuotaOptions
+
+	mu     sync.RWMutex
+	depths map[string]int64
+}
+
+// NewTenantQuotas returns quotas; call Run to start polling queue depths.
+func NewTenantQuotas(opts TenantQuotaOptions) *TenantQuotas {
+	if opts.Limiter == nil {
+		opts.Limiter = NewLocalLimiter(0)
+	}
+	return &TenantQuotas{opts: opts, depths: make(map[string]int64)}
+}
+
+func (q *TenantQuotas) quota(tenant string) TenantQuota {
+	if quota, ok := q.opts.Tenants[tenant]; ok {
+		return quota
+	}
+	return q.opts.Default
+}
+
+// Run polls every tenant's queue depth until ctx is done.
+func (q *TenantQuotas) Run(ctx context.Context, p *queue.Producer) {
+	if q == nil {
+		return
+	}
+	ticker := time.NewTicker(q.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		backlogs, err := p.TenantBacklogs(ctx)
+		if err != nil {
+			continue
+		}
+		depths := make(map[string]int64, len(backlogs))
+		byLabel := make(map[string]int64)
+		for tenant, b := range backlogs {
+			depths[tenant] = b.Depth
+			byLabel[queue.TenantLabel(tenant)] += b.Depth
+		}
+		for label, depth := range byLabel {
+			tenantQueueDepth.WithLabelValues(label).Set(float64(depth))
+		}
+		q.mu.Lock()
+		q.depths = depths
+		q.mu.Unlock()
+	}
+}
+
+// AdmitDepth reports whether tenant is below its queue-depth quota.
+func (q *TenantQuotas) AdmitDepth(tenant string) bool {
+	if q == nil {
+		return true
+	}
+	max := q.quota(tenant).MaxDepth
+	if max <= 0 {
+		return true
+	}
+	q.mu.RLock()
+	depth := q.depths[tenant]
+	q.mu.RUnlock()
+	if depth < max {
+		return true
+	}
+	tenantRejectionsTotal.WithLabelValues(queue.TenantLabel(tenant), "queue_depth").Inc()
+	return false
+}
+
+// rejectDepth answers a request from a tenant over its queue-depth quota.
+func (q *TenantQuotas) rejectDepth(c *gin.Context) {
+	c.Header("Retry-After", strconv.Itoa(ceilSeconds(q.opts.PollInterval)))
+	abortWithProblem(c, ProblemTenantQuota, "tenant queue depth quota exceeded")
+}
+
+// allowRate spends one token of tenant's request rate quota. Tenants without
+// a rate quota are always allowed.
+func (q *TenantQuotas) allowRate(ctx context.Context, tenant string) (RateLimitDecision, error) {
+	quota := q.quota(tenant)
+	if quota.RPS <= 0 {
+		return RateLimitDecision{Allowed: true}, nil
+	}
+	rule := RateLimitRule{RPS: quota.RPS, Burst: quota.Burst}
+	d, err := q.opts.Limiter.Allow(ctx, "tenant|"+tenant, rule)
+	if err == nil && !d.Allowed {
+		tenantRejectionsTotal.WithLabelValues(queue.TenantLabel(tenant), "rate").Inc()
+	}
+	return d, err
+}
+
+// TenantQuotaMiddleware rate limits authenticated requests per tenant.
+// Unauthenticated requests are left to RateLimitMiddleware.
+func TenantQuotaMiddleware(q *TenantQuotas) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := PrincipalFrom(c); !ok || c.FullPath() == "" {
+			c.Next()
+			return
+		}
+
+		d, err := q.allowRate(c.Request.Context(), tenantOf(c))
+		if err != nil {
+			log.Error().Err(err).Msg("Tenant rate limiter error")
+			c.Next()
+			return
+		}
+		if !d.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(d.RetryAfter)))
+			abortWithProblem(c, ProblemTenantQuota, "tenant request rate quota exceeded")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+)
+
+// APIVersionPrefix is where the current version of the business endpoints is mounted.
+const APIVersionPrefix = "/v1"
+
+var deprecatedRequestsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_deprecated_requests_total",
+		Help: "Requests served by deprecated route aliases; remove an alias once it stays at zero.",
+	},
+	[]string{"method", "route", "tenant"},
+)
+
+// unversionedRoute strips the version prefix from a route template. It is the
+// canonical form routes are compared in, so rate limits, policies and load
+// shedding apply alike to /jobs and /v1/jobs, whichever of them is configured.
+func unversionedRoute(route string) string {
+	if rest, ok := strings.CutPrefix(route, APIVersionPrefix+"/"); ok {
+		return "/" + rest
+	}
+	return route
+}
+
+// routeKey brings a configured "METHOD /route" or "/route" key to its canonical form.
+func routeKey(key string) string {
+	key = strings.TrimSpace(key)
+	if method, route, ok := strings.Cut(key, " "); ok {
+		return method + " " + unversionedRoute(strings.TrimSpace(route))
+	}
+	return unversionedRoute(key)
+}
+
+// DeprecationOptions describes the deprecated unversioned aliases of the business endpoints.
+type DeprecationOptions struct {
+	// Since is when the aliases were deprecated (Deprecation header, RFC 9745).
+	Since time.Time
+	// Sunset is when they will be removed (Sunset header, RFC 8594); zero omits it.
+	Sunset time.Time
+}
+
+// deprecatedRoute marks responses of a deprecated alias and counts its use,
+// pointing clients at the versioned successor.
+func deprecatedRoute(opts DeprecationOptions) gin.HandlerFunc {
+	deprecation := "@" + strconv.FormatInt(opts.Since.Unix(), 10)
+	sunset := ""
+	if !opts.Sunset.IsZero() {
+		sunset = opts.Sunset.UTC().Format(http.TimeFormat)
+	}
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		if sunset != "" {
+			c.Header("Sunset", sunset)
+		}
+		c.Header("Link", "<"+APIVersionPrefix+c.Request.URL.Path+`>; rel="successor-version"`)
+		deprecatedRequestsTotal.WithLabelValues(c.Request.Method, c.FullPath(), queue.TenantLabel(tenantOf(c))).Inc()
+		c.Next()
+	}
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+)
+
+// WorkflowStepRequest describes one job in a workflow.
+type WorkflowStepRequest struct {
+	ID string `json:"id"`
+	// Type names the kind of work, as for single jobs.
+	Type      string   `json:"type,omitempty"`
+	Payload   string   `json:"payload"`
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// WorkflowGroupRequest is a set of steps that run in parallel (fan-out). The
+// optional callback runs once every step of the group has succeeded (fan-in).
+// Other steps may depend on the group ID, which resolves to the callback, or to
+// all group steps when there is no callback.
+type WorkflowGroupRequest struct {
+	ID        string                `json:"id"`
+	DependsOn []string              `json:"depends_on,omitempty"`
+	Steps     []WorkflowStepRequest `json:"steps"`
+	Callback  *WorkflowStepRequest  `json:"callback,omitempty"`
+}
+
+// WorkflowRequest is the body of POST /workflows. Steps, Chain and Groups may be
+// combined; they are compiled into a single dependency graph.
+type WorkflowRequest struct {
+	Name string `json:"name"`
+	// Steps are free-form DAG nodes wired together with depends_on.
+	Steps []WorkflowStepRequest `json:"steps,omitempty"`
+	// Chain runs sequentially: each step depends on the previous one.
+	Chain []WorkflowStepRequest `json:"chain,omitempty"`
+	// Groups fan out to parallel steps and fan back in through a callback.
+	Groups []WorkflowGroupRequest `json:"groups,omitempty"`
+}
+
+// WorkflowLimits bounds the size of submitted workflows, since every step
+// completion loads and rewrites the whole workflow. Zero means unlimited.
+type WorkflowLimits struct {
+	// MaxSteps caps the number of steps after chains and groups are compiled.
+	MaxSteps int
+	// MaxDeps caps the dependencies of one step, counting each member of a
+	// group it depends on.
+	MaxDeps int
+}
+
+// compile flattens chains and groups into a list of steps with explicit
+// dependencies. Steps and groups share one ID space: a group ID equal to a step
+// ID would silently redirect dependencies on the step to the group.
+func (r WorkflowRequest) compile(limits WorkflowLimits) ([]*queue.Step, []FieldError) {
+	var (
+		steps      []*queue.Step
+		stepFields []string
+		fields     []FieldError
+	)
+	seen := make(map[string]string)
+	claim := func(id, field string) {
+		if id == "" {
+			return
+		}
+		if first, ok := seen[id]; ok {
+			fields = append(fields, FieldError{Field: field, Message: fmt.Sprintf("duplicate id %q, already used by %s", id, first)})
+			return
+		}
+		seen[id] = field
+	}
+	add := func(s WorkflowStepRequest, field string, extraDeps ...string) {
+		claim(s.ID, field)
+		deps := append(append([]string{}, s.DependsOn...), extraDeps...)
+		steps = append(steps, &queue.Step{ID: s.ID, Type: s.Type, Payload: s.Payload, DependsOn: deps})
+		stepFields = append(stepFields, strings.TrimSuffix(field, ".id"))
+	}
+
+	for i, s := range r.Steps {
+		add(s, fmt.Sprintf("steps[%d].id", i))
+	}
+
+	for i, s := range r.Chain {
+		field := fmt.Sprintf("chain[%d].id", i)
+		if i == 0 {
+			add(s, field)
+			continue
+		}
+		add(s, field, r.Chain[i-1].ID)
+	}
+
+	// Group IDs are aliases resolved after all steps are known.
+	groupTargets := make(map[string][]string)
+	for i, g := range r.Groups {
+		if g.ID == "" {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("groups[%d].id", i), Message: "is required"})
+			continue
+		}
+		claim(g.ID, fmt.Sprintf("groups[%d].id", i))
+		if len(g.Steps) == 0 {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("groups[%d].steps", i), Message: "must not be empty"})
+			continue
+		}
+		members := make([]string, 0, len(g.Steps))
+		for j, s := range g.Steps {
+			add(s, fmt.Sprintf("groups[%d].steps[%d].id", i, j), g.DependsOn...)
+			members = append(members, s.ID)
+		}
+		if g.Callback != nil {
+			add(*g.Callback, fmt.Sprintf("groups[%d].callback.id", i), members...)
+			groupTargets[g.ID] = []string{g.Callback.ID}
+		} else {
+			groupTargets[g.ID] = members
+		}
+	}
+	if limits.MaxSteps > 0 && len(steps) > limits.MaxSteps {
+		fields = append(fields, FieldError{Field: "steps", Message: fmt.Sprintf("workflow has %d steps, at most %d are allowed", len(steps), limits.MaxSteps)})
+	}
+	if len(fields) > 0 {
+		return nil, fields
+	}
+
+	for i, s := range steps {
+		var deps []string
+		for _, dep := range s.DependsOn {
+			if targets, ok := groupTargets[dep]; ok {
+				deps = append(deps, targets...)
+			} else {
+				deps = append(deps, dep)
+			}
+		}
+		s.DependsOn = deps
+		if limits.MaxDeps > 0 && len(deps) > limits.MaxDeps {
+			fields = append(fields, FieldError{Field: stepFields[i] + ".depends_on", Message: fmt.Sprintf("step has %d dependencies, at most %d are allowed", len(deps), limits.MaxDeps)})
+		}
+	}
+	if len(fields) > 0 {
+		return nil, fields
+	}
+	return steps, nil
+}
+
+func workflowSubmitHandler(c *gin.Context, p *queue.Producer, opts ServerOptions) {
+	var req WorkflowRequest
+	if !bindJSON(c, &req, nil) {
+		return
+	}
+
+	steps, fields := req.compile(opts.WorkflowLimits)
+	if len(fields) > 0 {
+		validationFailed(c, "invalid workflow", fields...)
+		return
+	}
+
+	// Workflow steps run at normal priority, so they are shed like normal jobs.
+	admission := opts.Admission
+	if !admission.Admit(queue.PriorityNormal) {
+		admission.reject(c)
+		return
+	}
+
+	tenant := tenantOf(c)
+	if !opts.Tenants.AdmitDepth(tenant) {
+		opts.Tenants.rejectDepth(c)
+		return
+	}
+
+	rid := c.GetString("request_id")
+	if rid == "" {
+		rid = "unknown"
+	}
+
+	wf := &queue.Workflow{
+		ID:        uuid.New().String(),
+		Name:      req.Name,
+		RequestID: rid,
+		Tenant:    tenant,
+		Steps:     steps,
+	}
+	if principal, ok := PrincipalFrom(c); ok {
+		wf.Principal = principal.ID
+	}
+	if err := wf.Validate(); err != nil {
+		validationFailed(c, err.Error())
+		return
+	}
+
+	if err := p.SubmitWorkflow(c.Request.Context(), wf); err != nil {
+		log.Error().Err(err).Msg("Failed to submit workflow")
+		abortWithProblem(c, ProblemServiceUnavailable, "workflow could not be stored")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": wf.Status, "workflow_id": wf.ID})
+}
+
+func workflowStatusHandler(c *gin.Context, p *queue.Producer) {
+	wf, err := p.GetWorkflow(c.Request.Context(), tenantOf(c), c.Param("id"))
+	if errors.Is(err, queue.ErrWorkflowNotFound) {
+		abortWithProblem(c, ProblemNotFound, "workflow not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load workflow")
+		abortWithProblem(c, ProblemServiceUnavailable, "workflow could not be loaded")
+		return
+	}
+
+	c.JSON(http.StatusOK, wf)
+}
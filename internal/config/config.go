@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -12,6 +13,120 @@ type Config struct {
 	RedisAddr      string `mapstructure:"REDIS_ADDR"`
 	RateLimitRPS   int    `mapstructure:"RATE_LIMIT_RPS"`
 	RateLimitBurst int    `mapstructure:"RATE_LIMIT_BURST"`
+	// Client identification: "ip", "api_key" or "header:<Name>"
+	RateLimitKey         string `mapstructure:"RATE_LIMIT_KEY"`
+	RateLimitRoutes      string `mapstructure:"RATE_LIMIT_ROUTES"`
+	RateLimitExemptPaths string `mapstructure:"RATE_LIMIT_EXEMPT_PATHS"`
+	RateLimitMaxClients  int    `mapstructure:"RATE_LIMIT_MAX_CLIENTS"`
+	// TrustedProxies (comma-separated IPs/CIDRs) may set X-Forwarded-For; empty trusts none.
+	TrustedProxies string `mapstructure:"TRUSTED_PROXIES"`
+	// "local" (per replica) or "redis" (shared GCRA, falls back to local)
+	RateLimitBackend string `mapstructure:"RATE_LIMIT_BACKEND"`
+
+	// Job payload encoding (compression + optional AES-GCM encryption at rest)
+	PayloadCompression         string `mapstructure:"PAYLOAD_COMPRESSION"`
+	PayloadEncryptionKeys      string `mapstructure:"PAYLOAD_ENCRYPTION_KEYS"`
+	PayloadEncryptionKeysDir   string `mapstructure:"PAYLOAD_ENCRYPTION_KEYS_DIR"`
+	PayloadEncryptionActiveKey string `mapstructure:"PAYLOAD_ENCRYPTION_ACTIVE_KEY"`
+	// Decompressed jobs larger than this are quarantined as malformed
+	PayloadMaxDecodedBytes int64 `mapstructure:"PAYLOAD_MAX_DECODED_BYTES"`
+
+	// Job envelope signing (HMAC-SHA256)
+	JobSigningKey     string `mapstructure:"JOB_SIGNING_KEY"`
+	JobSigningKeyFile string `mapstructure:"JOB_SIGNING_KEY_FILE"`
+	JobStrictMode     bool   `mapstructure:"JOB_STRICT_MODE"`
+
+	// Local outbox spool used while Redis is unavailable (disabled when SPOOL_DIR is empty)
+	SpoolDir           string        `mapstructure:"SPOOL_DIR"`
+	SpoolMaxBytes      int64         `mapstructure:"SPOOL_MAX_BYTES"`
+	SpoolMaxEntries    int           `mapstructure:"SPOOL_MAX_ENTRIES"`
+	SpoolRelayInterval time.Duration `mapstructure:"SPOOL_RELAY_INTERVAL"`
+	// Budget for relaying the remaining spool to Redis on shutdown
+	SpoolDrainTimeout time.Duration `mapstructure:"SPOOL_DRAIN_TIMEOUT"`
+
+	// Admission control on POST /jobs (a zero high watermark disables that signal)
+	AdmissionHighWatermark int64         `mapstructure:"ADMISSION_HIGH_WATERMARK"`
+	AdmissionLowWatermark  int64         `mapstructure:"ADMISSION_LOW_WATERMARK"`
+	AdmissionHighAge       time.Duration `mapstructure:"ADMISSION_HIGH_AGE"`
+	AdmissionLowAge        time.Duration `mapstructure:"ADMISSION_LOW_AGE"`
+	AdmissionShedPriority  string        `mapstructure:"ADMISSION_SHED_PRIORITY"`
+	AdmissionRejectStatus  int           `mapstructure:"ADMISSION_REJECT_STATUS"`
+	AdmissionRetryAfter    time.Duration `mapstructure:"ADMISSION_RETRY_AFTER"`
+	AdmissionPollInterval  time.Duration `mapstructure:"ADMISSION_POLL_INTERVAL"`
+
+	// API key authentication (keys are stored as SHA-256 hashes)
+	AuthEnabled         bool   `mapstructure:"AUTH_ENABLED"`
+	AuthAPIKeysFile     string `mapstructure:"AUTH_API_KEYS_FILE"`
+	AuthAPIKeysRedisKey string `mapstructure:"AUTH_API_KEYS_REDIS_KEY"`
+	AuthExemptPaths     string `mapstructure:"AUTH_EXEMPT_PATHS"`
+
+	// JWT bearer tokens verified against a JWKS (enabled when a URL or file is set)
+	AuthJWKSURL             string        `mapstructure:"AUTH_JWKS_URL"`
+	AuthJWKSFile            string        `mapstructure:"AUTH_JWKS_FILE"`
+	AuthJWKSRefreshInterval time.Duration `mapstructure:"AUTH_JWKS_REFRESH_INTERVAL"`
+	AuthJWTIssuer           string        `mapstructure:"AUTH_JWT_ISSUER"`
+	AuthJWTAudience         string        `mapstructure:"AUTH_JWT_AUDIENCE"`
+	AuthJWTLeeway           time.Duration `mapstructure:"AUTH_JWT_LEEWAY"`
+	AuthJWTRolesClaim       string        `mapstructure:"AUTH_JWT_ROLES_CLAIM"`
+	// Role to scope mapping: "platform-admin=admin,ci=jobs:write|jobs:read"
+	AuthJWTRoleScopes  string `mapstructure:"AUTH_JWT_ROLE_SCOPES"`
+	AuthJWTTenantClaim string `mapstructure:"AUTH_JWT_TENANT_CLAIM"`
+
+	// Declarative authorization policy (YAML or JSON); empty disables it
+	AuthPolicyFile string `mapstructure:"AUTH_POLICY_FILE"`
+
+	// Multi-tenancy: quotas are "rps:burst:max_depth" (0 = unlimited)
+	TenantQuotas           string        `mapstructure:"TENANT_QUOTAS"`
+	TenantDefaultQuota     string        `mapstructure:"TENANT_DEFAULT_QUOTA"`
+	TenantPollInterval     time.Duration `mapstructure:"TENANT_POLL_INTERVAL"`
+	TenantMetricsMaxLabels int           `mapstructure:"TENANT_METRICS_MAX_LABELS"`
+
+	// Adaptive concurrency limiting ("gradient" or "aimd")
+	ConcurrencyLimitEnabled   bool          `mapstructure:"CONCURRENCY_LIMIT_ENABLED"`
+	ConcurrencyLimitAlgorithm string        `mapstructure:"CONCURRENCY_LIMIT_ALGORITHM"`
+	ConcurrencyLimitInitial   int           `mapstructure:"CONCURRENCY_LIMIT_INITIAL"`
+	ConcurrencyLimitMin       int           `mapstructure:"CONCURRENCY_LIMIT_MIN"`
+	ConcurrencyLimitMax       int           `mapstructure:"CONCURRENCY_LIMIT_MAX"`
+	ConcurrencyCriticalPaths  string        `mapstructure:"CONCURRENCY_CRITICAL_PATHS"`
+	ConcurrencyBackground     string        `mapstructure:"CONCURRENCY_BACKGROUND_ROUTES"`
+	ConcurrencyAIMDTimeout    time.Duration `mapstructure:"CONCURRENCY_AIMD_TIMEOUT"`
+
+	// Dependency health checks behind /ready
+	HealthCheckTimeout  time.Duration `mapstructure:"HEALTH_CHECK_TIMEOUT"`
+	HealthCheckCacheTTL time.Duration `mapstructure:"HEALTH_CHECK_CACHE_TTL"`
+
+	// Graceful shutdown: fail /ready, wait the drain delay, then give
+	// in-flight requests (or the worker's current job) up to the timeout
+	ShutdownDrainDelay time.Duration `mapstructure:"SHUTDOWN_DRAIN_DELAY"`
+	ShutdownTimeout    time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
+
+	// Unversioned aliases of the /v1 routes (dates are YYYY-MM-DD)
+	LegacyRoutesEnabled      bool   `mapstructure:"LEGACY_ROUTES_ENABLED"`
+	LegacyRoutesDeprecatedAt string `mapstructure:"LEGACY_ROUTES_DEPRECATED_AT"`
+	LegacyRoutesSunset       string `mapstructure:"LEGACY_ROUTES_SUNSET"`
+
+	// gRPC JobService and grpc.health.v1 on their own port
+	GRPCEnabled       bool          `mapstructure:"GRPC_ENABLED"`
+	GRPCPort          string        `mapstructure:"GRPC_PORT"`
+	GRPCWatchInterval time.Duration `mapstructure:"GRPC_WATCH_INTERVAL"`
+
+	// Request body limits in bytes ("POST /jobs=65536,/workflows=1048576"; 0 = unlimited)
+	BodyLimitBytes  int64  `mapstructure:"BODY_LIMIT_BYTES"`
+	BodyLimitRoutes string `mapstructure:"BODY_LIMIT_ROUTES"`
+	// Job types whose requests may carry unknown JSON fields (migration escape hatch)
+	JSONLenientJobTypes string `mapstructure:"JSON_LENIENT_JOB_TYPES"`
+
+	// Workflow size limits, checked after chains and groups are compiled (0 = unlimited)
+	WorkflowMaxSteps int `mapstructure:"WORKFLOW_MAX_STEPS"`
+	WorkflowMaxDeps  int `mapstructure:"WORKFLOW_MAX_DEPS"`
+
+	// Logging; runtime level changes revert after a TTL
+	LogLevel       string        `mapstructure:"LOG_LEVEL"`
+	LogLevelTTL    time.Duration `mapstructure:"LOG_LEVEL_TTL"`
+	LogLevelMaxTTL time.Duration `mapstructure:"LOG_LEVEL_MAX_TTL"`
+
+	// Unauthenticated /debug/info and pprof listener, e.g. "127.0.0.1:6060" (empty = off)
+	AdminAddr string `mapstructure:"ADMIN_ADDR"`
 }
 
 func Load() (*Config, error) {
@@ -21,6 +136,78 @@ func Load() (*Config, error) {
 	viper.SetDefault("REDIS_ADDR", "localhost:6379")
 	viper.SetDefault("RATE_LIMIT_RPS", 100)
 	viper.SetDefault("RATE_LIMIT_BURST", 50)
+	viper.SetDefault("RATE_LIMIT_KEY", "ip")
+	viper.SetDefault("RATE_LIMIT_ROUTES", "")
+	viper.SetDefault("RATE_LIMIT_EXEMPT_PATHS", "/healthz,/ready,/metrics")
+	viper.SetDefault("RATE_LIMIT_MAX_CLIENTS", 10000)
+	viper.SetDefault("TRUSTED_PROXIES", "")
+	viper.SetDefault("RATE_LIMIT_BACKEND", "local")
+	viper.SetDefault("PAYLOAD_COMPRESSION", "none")
+	viper.SetDefault("PAYLOAD_ENCRYPTION_KEYS", "")
+	viper.SetDefault("PAYLOAD_ENCRYPTION_KEYS_DIR", "")
+	viper.SetDefault("PAYLOAD_ENCRYPTION_ACTIVE_KEY", "")
+	viper.SetDefault("PAYLOAD_MAX_DECODED_BYTES", 16<<20)
+	viper.SetDefault("JOB_SIGNING_KEY", "")
+	viper.SetDefault("JOB_SIGNING_KEY_FILE", "")
+	viper.SetDefault("JOB_STRICT_MODE", false)
+	viper.SetDefault("SPOOL_DIR", "")
+	viper.SetDefault("SPOOL_MAX_BYTES", 64<<20)
+	viper.SetDefault("SPOOL_MAX_ENTRIES", 100000)
+	viper.SetDefault("SPOOL_RELAY_INTERVAL", "1s")
+	viper.SetDefault("SPOOL_DRAIN_TIMEOUT", "5s")
+	viper.SetDefault("ADMISSION_HIGH_WATERMARK", 0)
+	viper.SetDefault("ADMISSION_LOW_WATERMARK", 0)
+	viper.SetDefault("ADMISSION_HIGH_AGE", "0s")
+	viper.SetDefault("ADMISSION_LOW_AGE", "0s")
+	viper.SetDefault("ADMISSION_SHED_PRIORITY", "normal")
+	viper.SetDefault("ADMISSION_REJECT_STATUS", 503)
+	viper.SetDefault("ADMISSION_RETRY_AFTER", "5s")
+	viper.SetDefault("ADMISSION_POLL_INTERVAL", "1s")
+	viper.SetDefault("AUTH_ENABLED", false)
+	viper.SetDefault("AUTH_API_KEYS_FILE", "")
+	viper.SetDefault("AUTH_API_KEYS_REDIS_KEY", "")
+	viper.SetDefault("AUTH_EXEMPT_PATHS", "/,/healthz,/ready,/metrics,/version,/openapi.json,/docs")
+	viper.SetDefault("AUTH_JWKS_URL", "")
+	viper.SetDefault("AUTH_JWKS_FILE", "")
+	viper.SetDefault("AUTH_JWKS_REFRESH_INTERVAL", "15m")
+	viper.SetDefault("AUTH_JWT_ISSUER", "")
+	viper.SetDefault("AUTH_JWT_AUDIENCE", "")
+	viper.SetDefault("AUTH_JWT_LEEWAY", "30s")
+	viper.SetDefault("AUTH_JWT_ROLES_CLAIM", "roles")
+	viper.SetDefault("AUTH_JWT_ROLE_SCOPES", "")
+	viper.SetDefault("AUTH_JWT_TENANT_CLAIM", "tenant")
+	viper.SetDefault("AUTH_POLICY_FILE", "")
+	viper.SetDefault("TENANT_QUOTAS", "")
+	viper.SetDefault("TENANT_DEFAULT_QUOTA", "")
+	viper.SetDefault("TENANT_POLL_INTERVAL", "5s")
+	viper.SetDefault("TENANT_METRICS_MAX_LABELS", 20)
+	viper.SetDefault("CONCURRENCY_LIMIT_ENABLED", false)
+	viper.SetDefault("CONCURRENCY_LIMIT_ALGORITHM", "gradient")
+	viper.SetDefault("CONCURRENCY_LIMIT_INITIAL", 100)
+	viper.SetDefault("CONCURRENCY_LIMIT_MIN", 10)
+	viper.SetDefault("CONCURRENCY_LIMIT_MAX", 1000)
+	viper.SetDefault("CONCURRENCY_CRITICAL_PATHS", "/healthz,/ready,/metrics,/version")
+	viper.SetDefault("CONCURRENCY_BACKGROUND_ROUTES", "")
+	viper.SetDefault("CONCURRENCY_AIMD_TIMEOUT", "1s")
+	viper.SetDefault("HEALTH_CHECK_TIMEOUT", "2s")
+	viper.SetDefault("HEALTH_CHECK_CACHE_TTL", "2s")
+	viper.SetDefault("SHUTDOWN_DRAIN_DELAY", "5s")
+	viper.SetDefault("SHUTDOWN_TIMEOUT", "15s")
+	viper.SetDefault("LEGACY_ROUTES_ENABLED", true)
+	viper.SetDefault("LEGACY_ROUTES_DEPRECATED_AT", "2026-10-18")
+	viper.SetDefault("LEGACY_ROUTES_SUNSET", "2027-04-30")
+	viper.SetDefault("GRPC_ENABLED", true)
+	viper.SetDefault("GRPC_PORT", "9090")
+	viper.SetDefault("GRPC_WATCH_INTERVAL", "1s")
+	viper.SetDefault("BODY_LIMIT_BYTES", 1<<20)
+	viper.SetDefault("BODY_LIMIT_ROUTES", "")
+	viper.SetDefault("JSON_LENIENT_JOB_TYPES", "")
+	viper.SetDefault("WORKFLOW_MAX_STEPS", 500)
+	viper.SetDefault("WORKFLOW_MAX_DEPS", 100)
+	viper.SetDefault("LOG_LEVEL", "info")
+	viper.SetDefault("LOG_LEVEL_TTL", "15m")
+	viper.SetDefault("LOG_LEVEL_MAX_TTL", "24h")
+	viper.SetDefault("ADMIN_ADDR", "")
 
 	// 2. Load from .env file (if present)
 	viper.SetConfigName(".env") // name of config file (without extension)
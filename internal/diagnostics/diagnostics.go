@@ -0,0 +1,150 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/sanjeevsethi/sre-platform-app/internal/metadata"
+)
+
+// Info is the runtime snapshot served at /debug/info.
+type Info struct {
+	Goroutines       int    `json:"goroutines"`
+	MemoryAlloc      uint64 `json:"memory_alloc"`
+	MemoryTotalAlloc uint64 `json:"memory_total_alloc"`
+	MemorySys        uint64 `json:"memory_sys"`
+	NumGC            uint32 `json:"num_gc"`
+	GOMAXPROCS       int    `json:"gomaxprocs"`
+	NumCPU           int    `json:"num_cpu"`
+	GC               GCInfo `json:"gc"`
+	Build            Build  `json:"build"`
+}
+
+// GCInfo summarizes garbage collector activity. Pause quantiles cover the
+// most recent pauses (up to 256).
+type GCInfo struct {
+	LastGC           time.Time `json:"last_gc"`
+	LastPauseNs      int64     `json:"last_pause_ns"`
+	PauseTotalNs     int64     `json:"pause_total_ns"`
+	PauseQuantilesNs Quantiles `json:"pause_quantiles_ns"`
+	CPUFraction      float64   `json:"cpu_fraction"`
+	NextGCBytes      uint64    `json:"next_gc_bytes"`
+	// MemoryLimitBytes is the soft limit set through GOMEMLIMIT (math.MaxInt64 when unset).
+	MemoryLimitBytes int64 `json:"memory_limit_bytes"`
+}
+
+// Quantiles of a distribution.
+type Quantiles struct {
+	Min int64 `json:"min"`
+	P25 int64 `json:"p25"`
+	P50 int64 `json:"p50"`
+	P75 int64 `json:"p75"`
+	Max int64 `json:"max"`
+}
+
+// Build combines the version injected at build time with what the Go
+// toolchain recorded in the binary.
+type Build struct {
+	metadata.BuildInfo
+	Module string `json:"module,omitempty"`
+	// Settings holds the VCS and target settings (vcs.revision, GOOS, ...).
+	Settings map[string]string `json:"settings,omitempty"`
+}
+
+// buildSettings are the debug.BuildInfo settings worth exposing; flags such
+// as -ldflags are left out.
+var buildSettings = []string{"GOOS", "GOARCH", "CGO_ENABLED", "GOAMD64", "GOARM64", "vcs", "vcs.revision", "vcs.time", "vcs.modified"}
+
+// Snapshot collects the current runtime statistics.
+func Snapshot() Info {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	var gc debug.GCStats
+	gc.PauseQuantiles = make([]time.Duration, 5)
+	debug.ReadGCStats(&gc)
+
+	info := Info{
+		Goroutines:       runtime.NumGoroutine(),
+		MemoryAlloc:      m.Alloc,
+		MemoryTotalAlloc: m.TotalAlloc,
+		MemorySys:        m.Sys,
+		NumGC:            m.NumGC,
+		GOMAXPROCS:       runtime.GOMAXPROCS(0),
+		NumCPU:           runtime.NumCPU(),
+		GC: GCInfo{
+			LastGC:       gc.LastGC,
+			PauseTotalNs: int64(gc.PauseTotal),
+			PauseQuantilesNs: Quantiles{
+				Min: int64(gc.PauseQuantiles[0]),
+				P25: int64(gc.PauseQuantiles[1]),
+				P50: int64(gc.PauseQuantiles[2]),
+				P75: int64(gc.PauseQuantiles[3]),
+				Max: int64(gc.PauseQuantiles[4]),
+			},
+			CPUFraction: m.GCCPUFraction,
+			NextGCBytes: m.NextGC,
+			// A negative limit reads the current one without changing it.
+			MemoryLimitBytes: debug.SetMemoryLimit(-1),
+		},
+		Build: Build{BuildInfo: metadata.GetBuildInfo()},
+	}
+	if len(gc.Pause) > 0 {
+		info.GC.LastPauseNs = int64(gc.Pause[0])
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Build.Module = bi.Main.Path
+		info.Build.Settings = make(map[string]string)
+		for _, s := range bi.Settings {
+			for _, key := range buildSettings {
+				if s.Key == key {
+					info.Build.Settings[s.Key] = s.Value
+				}
+			}
+		}
+	}
+	return info
+}
+
+// InfoHandler serves Snapshot as JSON.
+func InfoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Snapshot())
+	})
+}
+
+// PprofHandler serves net/http/pprof under /debug/pprof/: the index, the named
+// profiles (goroutine, heap, allocs, block, mutex, threadcreate; ?debug=2 dumps
+// every goroutine stack), the CPU profile, symbolization and the execution trace.
+func PprofHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/debug/pprof/") {
+		case "cmdline":
+			pprof.Cmdline(w, r)
+		case "profile":
+			pprof.Profile(w, r)
+		case "symbol":
+			pprof.Symbol(w, r)
+		case "trace":
+			pprof.Trace(w, r)
+		default:
+			pprof.Index(w, r)
+		}
+	})
+}
+
+// Handler serves /debug/info and /debug/pprof/ on a separate admin listener.
+// It has no authentication: bind it to a private address.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/info", InfoHandler())
+	mux.Handle("/debug/pprof/", PprofHandler())
+	return mux
+}
@@ -0,0 +1,249 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Check and report statuses.
+const (
+	StatusOK = "ok"
+	// StatusDegraded means only non-critical checks are failing; the service stays ready.
+	StatusDegraded = "degraded"
+	StatusFail     = "fail"
+	// StatusDraining means the service is shutting down and must not get new traffic.
+	StatusDraining = "draining"
+)
+
+const defaultTimeout = 2 * time.Second
+
+// Health check metrics
+var (
+	checkStatus = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "health_check_status",
+			Help: "Result of the last health check run (1 = ok, 0 = failing).",
+		},
+		[]string{"check", "critical"},
+	)
+	checkDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "health_check_duration_seconds",
+			Help:    "Duration of health check runs.",
+			Buckets: []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5},
+		},
+		[]string{"check"},
+	)
+	checkFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "health_check_failures_total",
+			Help: "Total number of failed health check runs.",
+		},
+		[]string{"check"},
+	)
+)
+
+// Check is a dependency probe registered by a component.
+type Check struct {
+	Name string
+	// Func returns nil when the dependency is healthy. It must honour ctx.
+	Func func(ctx context.Context) error
+	// Timeout bounds a single run (default 2s).
+	Timeout time.Duration
+	// CacheTTL reuses the last result for this long, so frequent probes
+	// do not hammer the dependency. Zero runs the check on every request.
+	CacheTTL time.Duration
+	// Critical checks make the service unready when they fail; non-critical
+	// ones only mark it degraded.
+	Critical bool
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	Cached    bool      `json:"cached"`
+}
+
+// Report aggregates all check results.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Ready reports whether every critical check passed and the service is not draining.
+func (r Report) Ready() bool {
+	return r.Status != StatusFail && r.Status != StatusDraining
+}
+
+type entry struct {
+	check Check
+
+	// mu serialises runs, so concurrent probes share one in-flight check.
+	mu   sync.Mutex
+	last Result
+}
+
+// Registry holds the checks of a service.
+type Registry struct {
+	mu     sync.RWMutex
+	checks []*entry
+
+	draining atomic.Bool
+}
+
+// NewRegistry returns an empty registry. With no checks registered the service is always ready.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a check. Names must be unique.
+func (r *Registry) Register(c Check) error {
+	if c.Name == "" || c.Func == nil {
+		return errors.New("health: a check needs a name and a func")
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.checks {
+		if e.check.Name == c.Name {
+			return fmt.Errorf("health: check %q already registered", c.Name)
+		}
+	}
+	r.checks = append(r.checks, &entry{check: c})
+	return nil
+}
+
+// SetDraining fails readiness from now on, whatever the checks say, so the
+// load balancer stops routing to a service that is shutting down.
+func (r *Registry) SetDraining() {
+	r.draining.Store(true)
+}
+
+// Run executes all checks concurrently (or reuses cached results) and aggregates them.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]*entry(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, e := range checks {
+		wg.Add(1)
+		go func(i int, e *entry) {
+			defer wg.Done()
+			results[i] = e.run(ctx)
+		}(i, e)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, res := range results {
+		if res.Status == StatusOK {
+			continue
+		}
+		if res.Critical {
+			report.Status = StatusFail
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	if r.draining.Load() {
+		report.Status = StatusDraining
+	}
+	return report
+}
+
+func (e *entry) run(ctx context.Context) Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.check.CacheTTL > 0 && !e.last.CheckedAt.IsZero() && time.Since(e.last.CheckedAt) < e.check.CacheTTL {
+		res := e.last
+		res.Cached = true
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := runWithContext(ctx, e.check.Func)
+	elapsed := time.Since(start)
+
+	res := Result{
+		Name:      e.check.Name,
+		Status:    StatusOK,
+		Critical:  e.check.Critical,
+		LatencyMs: float64(elapsed.Microseconds()) / 1000,
+		CheckedAt: start,
+	}
+	critical := "false"
+	if e.check.Critical {
+		critical = "true"
+	}
+	checkDuration.WithLabelValues(e.check.Name).Observe(elapsed.Seconds())
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+		checkFailuresTotal.WithLabelValues(e.check.Name).Inc()
+		checkStatus.WithLabelValues(e.check.Name, critical).Set(0)
+	} else {
+		checkStatus.WithLabelValues(e.check.Name, critical).Set(1)
+	}
+	e.last = res
+	return res
+}
+
+// runWithContext returns when fn does or ctx expires, whichever is first,
+// so a check that ignores its context cannot hang the probe.
+func runWithContext(ctx context.Context, fn func(context.Context) error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out: %w", ctx.Err())
+	}
+}
+
+// ReadyHandler answers readiness probes: 200 "ready" or 503 "not ready".
+func (r *Registry) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !r.Run(req.Context()).Ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ready"))
+	})
+}
+
+// DetailsHandler serves the full report as JSON, with 503 when not ready.
+func (r *Registry) DetailsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Run(req.Context())
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
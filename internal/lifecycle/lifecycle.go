@@ -0,0 +1,171 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const defaultStopTimeout = 10 * time.Second
+
+// Component is one part of a service managed by a Group. All funcs are optional.
+type Component struct {
+	Name string
+	// Start initialises the component. Components start in the order they
+	// were added, and a failing Start aborts the ones after it.
+	Start func(ctx context.Context) error
+	// Run is the component's long-running loop. It must return once ctx is
+	// cancelled. Returning nil earlier means it has nothing to do (e.g. a
+	// disabled feature); returning an error means the component died and
+	// shuts the whole service down.
+	Run func(ctx context.Context) error
+	// Stop releases the component. Components stop in reverse order, each
+	// after the ones that depend on it, and Run's ctx is cancelled once Stop returns.
+	Stop func(ctx context.Context) error
+	// StopTimeout bounds Stop and the wait for Run to return (default 10s).
+	StopTimeout time.Duration
+}
+
+// HTTPServer runs srv as a component. stop shuts it down; nil uses srv.Shutdown.
+func HTTPServer(name string, srv *http.Server, stop func(ctx context.Context) error) Component {
+	if stop == nil {
+		stop = srv.Shutdown
+	}
+	return Component{
+		Name: name,
+		Run: func(ctx context.Context) error {
+			log.Info().Str("component", name).Str("addr", srv.Addr).Msg("Listening")
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			// Closed by Stop; wait for the group to cancel us.
+			<-ctx.Done()
+			return nil
+		},
+		Stop: stop,
+	}
+}
+
+// Group starts components in order, runs them until a signal arrives or one
+// of them dies, then stops them in reverse order.
+type Group struct {
+	components []Component
+}
+
+// New returns an empty group.
+func New() *Group {
+	return &Group{}
+}
+
+// Add appends a component; it starts after and stops before the ones added earlier.
+func (g *Group) Add(c Component) {
+	if c.StopTimeout <= 0 {
+		c.StopTimeout = defaultStopTimeout
+	}
+	g.components = append(g.components, c)
+}
+
+type running struct {
+	c      Component
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type exit struct {
+	name string
+	err  error
+}
+
+// Run blocks until SIGINT/SIGTERM, ctx cancellation or the death of a
+// component, then shuts everything down. It returns the error that caused
+// the shutdown (nil for a signal) joined with any stop errors.
+func (g *Group) Run(ctx context.Context) error {
+	sigCtx, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	exits := make(chan exit, len(g.components))
+	started := make([]*running, 0, len(g.components))
+
+	var cause error
+	for _, c := range g.components {
+		if c.Start != nil {
+			log.Info().Str("component", c.Name).Msg("Starting component")
+			if err := c.Start(sigCtx); err != nil {
+				cause = fmt.Errorf("start %s: %w", c.Name, err)
+				break
+			}
+		}
+
+		runCtx, cancel := context.WithCancel(context.Background())
+		r := &running{c: c, cancel: cancel, done: make(chan struct{})}
+		started = append(started, r)
+		if c.Run == nil {
+			close(r.done)
+			continue
+		}
+		go func() {
+			defer close(r.done)
+			if err := c.Run(runCtx); err != nil && runCtx.Err() == nil {
+				exits <- exit{name: c.Name, err: err}
+			}
+		}()
+	}
+
+	if cause == nil {
+		log.Info().Int("components", len(started)).Msg("All components started")
+		select {
+		case <-sigCtx.Done():
+			log.Info().Msg("Shutdown signal received")
+		case e := <-exits:
+			cause = fmt.Errorf("%s: %w", e.name, e.err)
+		}
+	}
+	if cause != nil {
+		log.Error().Err(cause).Msg("Component failed, shutting down")
+	}
+
+	errs := []error{cause}
+	for i := len(started) - 1; i >= 0; i-- {
+		errs = append(errs, started[i].stop())
+	}
+	return errors.Join(errs...)
+}
+
+func (r *running) stop() error {
+	name := r.c.Name
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), r.c.StopTimeout)
+	defer cancel()
+
+	var err error
+	if r.c.Stop != nil {
+		stopErr := make(chan error, 1)
+		go func() { stopErr <- r.c.Stop(ctx) }()
+		select {
+		case err = <-stopErr:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	r.cancel()
+
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		err = errors.Join(err, errors.New("run did not return"))
+	}
+
+	if err != nil {
+		log.Error().Err(err).Str("component", name).Dur("timeout", r.c.StopTimeout).Msg("Component did not stop cleanly")
+		return fmt.Errorf("stop %s: %w", name, err)
+	}
+	log.Info().Str("component", name).Dur("duration", time.Since(start)).Msg("Component stopped")
+	return nil
+}
@@ -0,0 +1,76 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestNoOpRunKeepsGroupRunning checks that a Run returning nil before
+// cancellation (a disabled feature) does not shut the service down.
+func TestNoOpRunKeepsGroupRunning(t *testing.T) {
+	g := New()
+	g.Add(Component{Name: "disabled", Run: func(context.Context) error { return nil }})
+	stopped := false
+	g.Add(Component{
+		Name: "server",
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		},
+		Stop: func(context.Context) error {
+			stopped = true
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- g.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("group stopped before cancellation: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("group did not stop after cancellation")
+	}
+	if !stopped {
+		t.Error("server component was not stopped")
+	}
+}
+
+// TestFailingRunStopsGroup checks that a Run returning an error shuts the service down.
+func TestFailingRunStopsGroup(t *testing.T) {
+	boom := errors.New("boom")
+	g := New()
+	g.Add(Component{
+		Name: "server",
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		},
+	})
+	g.Add(Component{Name: "broken", Run: func(context.Context) error { return boom }})
+
+	done := make(chan error, 1)
+	go func() { done <- g.Run(context.Background()) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, boom) {
+			t.Fatalf("Run() = %v, want %v", err, boom)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("group did not stop after a component failed")
+	}
+}
@@ -0,0 +1,219 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Global names the process-wide level; modules without their own level follow it.
+const Global = "global"
+
+// Modules whose level can be changed independently at runtime.
+const (
+	ModuleAPI    = "api"
+	ModuleWorker = "worker"
+	ModuleQueue  = "queue"
+)
+
+// Modules lists the modules with their own logger.
+var Modules = []string{ModuleAPI, ModuleWorker, ModuleQueue}
+
+// ErrUnknownModule is returned when changing the level of a module that does not exist.
+var ErrUnknownModule = errors.New("unknown log module")
+
+// LevelChange sets the level of the global logger or of one module until
+// ExpiresAt. An empty Level reverts to the configured level.
+type LevelChange struct {
+	Module    string    `json:"module"`
+	Level     string    `json:"level,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// LevelStatus is the current level of the global logger or of a module.
+type LevelStatus struct {
+	Module string `json:"module"`
+	Level  string `json:"level"`
+	// Override is set while a runtime change is in effect, until ExpiresAt.
+	Override  bool       `json:"override"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type override struct {
+	level     zerolog.Level
+	expiresAt time.Time
+	timer     *time.Timer
+}
+
+// levelState holds the configured level and the runtime overrides. Effective
+// levels are cached in atomics, so the hooks never take the lock.
+type levelState struct {
+	mu         sync.Mutex
+	configured zerolog.Level
+	overrides  map[string]*override
+	effective  map[string]*atomic.Int32
+}
+
+var levels = newLevelState()
+
+func newLevelState() *levelState {
+	s := &levelState{
+		configured: zerolog.InfoLevel,
+		overrides:  make(map[string]*override),
+		effective:  make(map[string]*atomic.Int32),
+	}
+	for _, m := range append([]string{Global}, Modules...) {
+		s.effective[m] = new(atomic.Int32)
+	}
+	s.configure(zerolog.InfoLevel)
+	return s
+}
+
+func (s *levelState) configure(l zerolog.Level) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configured = l
+	s.refresh()
+}
+
+// refresh recomputes the effective levels. zerolog's global level is the most
+// verbose of them, so that the hooks get to see every event they may keep.
+func (s *levelState) refresh() {
+	global := s.configured
+	if o, ok := s.overrides[Global]; ok {
+		global = o.level
+	}
+	lowest := global
+	for m, eff := range s.effective {
+		l := global
+		if o, ok := s.overrides[m]; ok && m != Global {
+			l = o.level
+		}
+		eff.Store(int32(l))
+		lowest = min(lowest, l)
+	}
+	zerolog.SetGlobalLevel(lowest)
+}
+
+// levelOf returns the effective level of a module; unknown modules follow the global level.
+func (s *levelState) levelOf(module string) zerolog.Level {
+	eff, ok := s.effective[module]
+	if !ok {
+		eff = s.effective[Global]
+	}
+	return zerolog.Level(eff.Load())
+}
+
+// levelHook drops events below the effective level of its module.
+type levelHook struct {
+	module string
+}
+
+func (h levelHook) Run(e *zerolog.Event, l zerolog.Level, _ string) {
+	if l != zerolog.NoLevel && l < levels.levelOf(h.module) {
+		e.Discard()
+	}
+}
+
+// Apply sets or reverts a level. Overrides revert by themselves at ExpiresAt;
+// a change that already expired reverts immediately.
+func Apply(c LevelChange) error {
+	if c.Module == "" {
+		c.Module = Global
+	}
+	if c.Module != Global && !slices.Contains(Modules, c.Module) {
+		return fmt.Errorf("%w %q", ErrUnknownModule, c.Module)
+	}
+	var l zerolog.Level
+	if c.Level != "" {
+		var err error
+		if l, err = ParseOverrideLevel(c.Level); err != nil {
+			return err
+		}
+	}
+
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	if o, ok := levels.overrides[c.Module]; ok {
+		if o.timer != nil {
+			o.timer.Stop()
+		}
+		delete(levels.overrides, c.Module)
+	}
+	if c.Level != "" && (c.ExpiresAt.IsZero() || time.Until(c.ExpiresAt) > 0) {
+		o := &override{level: l, expiresAt: c.ExpiresAt}
+		if !c.ExpiresAt.IsZero() {
+			o.timer = time.AfterFunc(time.Until(c.ExpiresAt), func() { levels.expire(c.Module, o) })
+		}
+		levels.overrides[c.Module] = o
+	}
+	levels.refresh()
+	return nil
+}
+
+// expire reverts an override whose TTL ran out, unless it was replaced meanwhile.
+func (s *levelState) expire(module string, o *override) {
+	s.mu.Lock()
+	if s.overrides[module] != o {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.overrides, module)
+	s.refresh()
+	level := s.levelOf(module)
+	s.mu.Unlock()
+
+	log.Log().
+		Bool("audit", true).
+		Str("event", "log_level_reverted").
+		Str("target_module", module).
+		Str("from", o.level.String()).
+		Str("to", level.String()).
+		Msg("Log level override expired")
+}
+
+// Levels returns the effective level of the global logger and of every module.
+func Levels() []LevelStatus {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	out := make([]LevelStatus, 0, len(Modules)+1)
+	for _, m := range append([]string{Global}, Modules...) {
+		st := LevelStatus{Module: m, Level: levels.levelOf(m).String()}
+		if o, ok := levels.overrides[m]; ok {
+			st.Override = true
+			if !o.expiresAt.IsZero() {
+				expires := o.expiresAt
+				st.ExpiresAt = &expires
+			}
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// OverrideLevels are the levels a runtime change may set. Panic and disabled
+// would also silence the audit records of level changes.
+var OverrideLevels = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// ParseOverrideLevel parses a level for a runtime change.
+func ParseOverrideLevel(level string) (zerolog.Level, error) {
+	if !slices.Contains(OverrideLevels, level) {
+		return zerolog.NoLevel, fmt.Errorf("invalid log level %q for a runtime change: want trace, debug, info, warn, error or fatal", level)
+	}
+	return ParseLevel(level)
+}
+
+// ParseLevel parses a level name, rejecting the empty string that zerolog accepts.
+func ParseLevel(level string) (zerolog.Level, error) {
+	l, err := zerolog.ParseLevel(level)
+	if err != nil || level == "" || l == zerolog.NoLevel {
+		return l, fmt.Errorf("invalid log level %q: want trace, debug, info, warn, error, fatal, panic or disabled", level)
+	}
+	return l, nil
+}
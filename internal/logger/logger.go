@@ -1,27 +1,51 @@
 package logger
 
 import (
+	"io"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// output is shared by the global and module loggers, which are created before Init runs.
+var output atomic.Pointer[io.Writer]
+
+type outputWriter struct{}
+
+func (outputWriter) Write(p []byte) (int, error) {
+	return (*output.Load()).Write(p)
+}
+
+func init() {
+	var w io.Writer = os.Stderr
+	output.Store(&w)
+	log.Logger = zerolog.New(outputWriter{}).With().Timestamp().Logger().Hook(levelHook{module: Global})
+}
+
 // Init configures the global zerolog logger.
 // For production, it uses JSON format.
 // For local development (if pretty=true), it uses ConsoleWriter.
 func Init(level string, pretty bool) {
 	// Set Log Level
 	l, err := zerolog.ParseLevel(level)
-	if err != nil {
+	if err != nil || level == "" {
 		l = zerolog.InfoLevel
 	}
-	zerolog.SetGlobalLevel(l)
+	levels.configure(l)
 
 	if pretty {
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+		var w io.Writer = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
+		output.Store(&w)
 	} else {
 		zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	}
 }
+
+// Module returns the logger of a module. Its events carry a "module" field and
+// follow the module's level when one is set, and the global level otherwise.
+func Module(name string) zerolog.Logger {
+	return zerolog.New(outputWriter{}).With().Timestamp().Str("module", name).Logger().Hook(levelHook{module: name})
+}
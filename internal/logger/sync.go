@@ -0,0 +1,137 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/extra/redisotel/v8"
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// levelChannel is the Redis channel level changes are published on.
+const levelChannel = "loglevel"
+
+// levelKey holds the change in effect for a module, expiring with it, so that
+// replicas started later pick it up.
+func levelKey(module string) string {
+	return "loglevel:" + module
+}
+
+// LevelSync shares runtime level changes between all api-service and
+// worker-service replicas through Redis.
+type LevelSync struct {
+	client *redis.Client
+}
+
+// NewLevelSync connects to Redis at addr.
+func NewLevelSync(addr string) *LevelSync {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	// Enable tracing
+	rdb.AddHook(redisotel.NewTracingHook())
+	return &LevelSync{client: rdb}
+}
+
+// Publish stores and broadcasts a change; every replica, this one included, applies it.
+func (s *LevelSync) Publish(ctx context.Context, c LevelChange) error {
+	if c.Module == "" {
+		c.Module = Global
+	}
+	// A non-positive expiry would store the change forever.
+	ttl := time.Until(c.ExpiresAt)
+	if c.Level != "" && ttl <= 0 {
+		return fmt.Errorf("publish log level change: expiry %s is not in the future", c.ExpiresAt)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if c.Level == "" {
+			pipe.Del(ctx, levelKey(c.Module))
+		} else {
+			pipe.Set(ctx, levelKey(c.Module), data, ttl)
+		}
+		pipe.Publish(ctx, levelChannel, data)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("publish log level change: %w", err)
+	}
+	return nil
+}
+
+// Run applies the changes in effect, then every published change until ctx is
+// done. It resubscribes after Redis errors.
+func (s *LevelSync) Run(ctx context.Context) {
+	for {
+		err := s.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn().Err(err).Msg("Log level sync interrupted, retrying")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(syncRetryInterval):
+		}
+	}
+}
+
+// syncRetryInterval is how long Run waits before resubscribing.
+const syncRetryInterval = 5 * time.Second
+
+func (s *LevelSync) run(ctx context.Context) error {
+	sub := s.client.Subscribe(ctx, levelChannel)
+	defer sub.Close()
+	// Subscribe before loading, so no change falls in between.
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("subscribe to log level changes: %w", err)
+	}
+	for _, m := range append([]string{Global}, Modules...) {
+		data, err := s.client.Get(ctx, levelKey(m)).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("load log level of %s: %w", m, err)
+		}
+		s.apply(data)
+	}
+
+	msgs := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-msgs:
+			if !ok {
+				return errors.New("subscription closed")
+			}
+			s.apply([]byte(msg.Payload))
+		}
+	}
+}
+
+func (s *LevelSync) apply(data []byte) {
+	var c LevelChange
+	if err := json.Unmarshal(data, &c); err != nil {
+		log.Error().Err(err).Msg("Ignoring malformed log level change")
+		return
+	}
+	if err := Apply(c); err != nil {
+		log.Error().Err(err).Str("target_module", c.Module).Msg("Ignoring invalid log level change")
+		return
+	}
+	log.Info().Str("target_module", c.Module).Str("to", levels.levelOf(c.Module).String()).Time("expires_at", c.ExpiresAt).Msg("Applied log level change")
+}
+
+// Close closes the Redis connection.
+func (s *LevelSync) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,357 @@
+package queue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sanjeevsethi/sre-platform-app/internal/config"
+)
+
+// Supported payload compression algorithms.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// DefaultMaxDecodedSize caps a decompressed job when CodecOptions.MaxDecodedSize
+// is unset, so a small compressed entry cannot expand into gigabytes.
+const DefaultMaxDecodedSize = 16 << 20
+
+// envelopeVersion is bumped whenever the envelope layout changes.
+const envelopeVersion = 1
+
+// Decode errors. Callers use errors.Is to decide whether to quarantine an entry.
+var (
+	// ErrMalformed is returned when the raw queue entry is neither a Job nor an Envelope
+	// and the legacy fallback is disabled.
+	ErrMalformed = errors.New("malformed queue entry")
+	// ErrUnsigned is returned when signing is enabled but the entry carries no signature.
+	ErrUnsigned = errors.New("unsigned queue entry")
+	// ErrBadSignature is returned when the envelope signature does not verify.
+	ErrBadSignature = errors.New("invalid queue entry signature")
+)
+
+// jobSize tracks how much each job takes in Redis, for capacity planning.
+// "payload" is the client payload, "encoded" the stored entry after
+// compression, encryption and the envelope.
+var jobSize = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "queue_job_size_bytes",
+		Help:    "Size of enqueued jobs, by part (payload or encoded entry).",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 10), // 64B .. 16MiB
+	},
+	[]string{"tenant", "part"},
+)
+
+// LegacyJobID marks jobs reconstructed from raw, non-JSON queue entries.
+const LegacyJobID = "legacy"
+
+// Envelope is the wire format pushed to Redis when compression, encryption or
+// signing is enabled. Data holds the JSON-encoded Job after compression and then
+// encryption; Signature is an HMAC-SHA256 over the header and Data.
+type Envelope struct {
+	Version     int    `json:"v"`
+	Compression string `json:"comp,omitempty"`
+	KeyID       string `json:"kid,omitempty"`
+	Data        []byte `json:"data"`
+	Signature   []byte `json:"sig,omitempty"`
+}
+
+// CodecOptions configures a Codec.
+type CodecOptions struct {
+	// Compression is one of CompressionNone, CompressionGzip or CompressionZstd.
+	Compression string
+	// Keyring enables AES-GCM encryption when non-nil.
+	Keyring *Keyring
+	// SigningKey enables HMAC-SHA256 envelope signatures when non-empty.
+	// Decode then rejects unsigned and tampered entries.
+	SigningKey []byte
+	// Strict disables the legacy fallback that turns raw non-JSON entries into jobs.
+	Strict bool
+	// MaxDecodedSize caps the decompressed size of a job (default
+	// DefaultMaxDecodedSize); larger entries fail with ErrMalformed.
+	MaxDecodedSize int64
+}
+
+// Codec converts Jobs to and from their Redis representation.
+// A nil *Codec is valid and reads/writes plain JSON jobs.
+type Codec struct {
+	compression string
+	keyring     *Keyring
+	signingKey  []byte
+	strict      bool
+	maxDecoded  int64
+	zenc        *zstd.Encoder
+	zdec        *zstd.Decoder
+}
+
+// NewCodec validates the options and returns a ready-to-use Codec.
+func NewCodec(opts CodecOptions) (*Codec, error) {
+	c := &Codec{
+		compression: opts.Compression,
+		keyring:     opts.Keyring,
+		signingKey:  opts.SigningKey,
+		strict:      opts.Strict,
+		maxDecoded:  opts.MaxDecodedSize,
+	}
+	if c.compression == "" {
+		c.compression = CompressionNone
+	}
+	if c.maxDecoded <= 0 {
+		c.maxDecoded = DefaultMaxDecodedSize
+	}
+
+	switch c.compression {
+	case CompressionNone, CompressionGzip:
+	case CompressionZstd:
+		var err error
+		if c.zenc, err = zstd.NewWriter(nil); err != nil {
+			return nil, fmt.Errorf("codec: init zstd encoder: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("codec: unsupported compression %q", c.compression)
+	}
+
+	// The decoder is always available so a consumer can read jobs written by a
+	// producer with a different compression setting (e.g. during a rollout).
+	// Its window and output are bounded by the decoded size limit.
+	window := uint64(c.maxDecoded)
+	if window < zstd.MinWindowSize {
+		window = zstd.MinWindowSize
+	}
+	zdec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(c.maxDecoded)), zstd.WithDecoderMaxWindow(window))
+	if err != nil {
+		return nil, fmt.Errorf("codec: init zstd decoder: %w", err)
+	}
+	c.zdec = zdec
+
+	return c, nil
+}
+
+// NewCodecFromConfig builds the Codec described by the service configuration.
+func NewCodecFromConfig(cfg *config.Config) (*Codec, error) {
+	keyring, err := LoadKeyring(cfg.PayloadEncryptionKeys, cfg.PayloadEncryptionKeysDir, cfg.PayloadEncryptionActiveKey)
+	if err != nil {
+		return nil, err
+	}
+	signingKey := []byte(cfg.JobSigningKey)
+	if cfg.JobSigningKeyFile != "" {
+		content, err := os.ReadFile(cfg.JobSigningKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("codec: read signing key: %w", err)
+		}
+		signingKey = []byte(strings.TrimSpace(string(content)))
+	}
+	return NewCodec(CodecOptions{
+		Compression:    cfg.PayloadCompression,
+		Keyring:        keyring,
+		SigningKey:     signingKey,
+		Strict:         cfg.JobStrictMode,
+		MaxDecodedSize: cfg.PayloadMaxDecodedBytes,
+	})
+}
+
+// Signing reports whether envelopes are signed and verified.
+func (c *Codec) Signing() bool {
+	return c != nil && len(c.signingKey) > 0
+}
+
+// Encode serializes a job. Without compression, encryption or signing the output
+// is the plain JSON job, which keeps older workers able to read it.
+func (c *Codec) Encode(job Job) ([]byte, error) {
+	data, err := c.encode(job)
+	if err != nil {
+		return nil, err
+	}
+	tenant := TenantLabel(job.Tenant)
+	jobSize.WithLabelValues(tenant, "payload").Observe(float64(len(job.Payload)))
+	jobSize.WithLabelValues(tenant, "encoded").Observe(float64(len(data)))
+	return data, nil
+}
+
+func (c *Codec) encode(job Job) ([]byte, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil || (c.compression == CompressionNone && c.keyring == nil && !c.Signing()) {
+		return data, nil
+	}
+
+	env := Envelope{Version: envelopeVersion}
+
+	if c.compression != CompressionNone {
+		if data, err = c.compress(data); err != nil {
+			return nil, err
+		}
+		env.Compression = c.compression
+	}
+
+	if c.keyring != nil {
+		env.KeyID = c.keyring.ActiveKeyID()
+		if _, data, err = c.keyring.Seal(data, env.additionalData()); err != nil {
+			return nil, err
+		}
+	}
+
+	env.Data = data
+	if c.Signing() {
+		env.Signature = env.sign(c.signingKey)
+	}
+	return json.Marshal(env)
+}
+
+// Decode parses a raw queue entry written by Encode (with any codec settings).
+//
+// Raw entries that are not JSON are returned as legacy jobs (ID LegacyJobID)
+// unless the codec is strict, in which case ErrMalformed is returned. When
+// signing is enabled, every entry must be a validly signed envelope, otherwise
+// ErrUnsigned or ErrBadSignature is returned.
+func (c *Codec) Decode(raw []byte) (Job, error) {
+	var probe struct {
+		Envelope
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		if c != nil && c.strict {
+			return Job{}, ErrMalformed
+		}
+		// Legacy jobs carry no signature.
+		if c.Signing() {
+			return Job{}, ErrUnsigned
+		}
+		// Handle legacy string jobs or malformed JSON
+		return Job{
+			ID:        LegacyJobID,
+			Payload:   string(raw),
+			RequestID: "unknown",
+		}, nil
+	}
+
+	var job Job
+	if probe.Version == 0 {
+		// Plain JSON job written without a codec.
+		if c.Signing() {
+			return Job{}, ErrUnsigned
+		}
+		if err := json.Unmarshal(raw, &job); err != nil {
+			return Job{}, ErrMalformed
+		}
+		return job, nil
+	}
+
+	if c.Signing() {
+		if len(probe.Signature) == 0 {
+			return Job{}, ErrUnsigned
+		}
+		if !hmac.Equal(probe.Signature, probe.sign(c.signingKey)) {
+			return Job{}, ErrBadSignature
+		}
+	}
+
+	data, err := c.open(probe.Envelope)
+	if err != nil {
+		return Job{}, err
+	}
+	if err := json.Unmarshal(data, &job); err != nil {
+		return Job{}, fmt.Errorf("codec: decode job: %w", err)
+	}
+	return job, nil
+}
+
+func (c *Codec) open(env Envelope) ([]byte, error) {
+	if env.Version != envelopeVersion {
+		return nil, fmt.Errorf("codec: unsupported envelope version %d", env.Version)
+	}
+
+	data := env.Data
+	if env.KeyID != "" {
+		if c == nil || c.keyring == nil {
+			return nil, fmt.Errorf("codec: job encrypted with key %q but no keyring configured", env.KeyID)
+		}
+		var err error
+		if data, err = c.keyring.Open(env.KeyID, data, env.additionalData()); err != nil {
+			return nil, err
+		}
+	}
+
+	switch env.Compression {
+	case "", CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("codec: gzip: %w", err)
+		}
+		defer zr.Close()
+		limit := int64(DefaultMaxDecodedSize)
+		if c != nil {
+			limit = c.maxDecoded
+		}
+		out, err := io.ReadAll(io.LimitReader(zr, limit+1))
+		if err != nil {
+			return nil, fmt.Errorf("codec: gzip: %w", err)
+		}
+		if int64(len(out)) > limit {
+			return nil, fmt.Errorf("%w: decompressed job exceeds %d bytes", ErrMalformed, limit)
+		}
+		return out, nil
+	case CompressionZstd:
+		if c == nil || c.zdec == nil {
+			return nil, fmt.Errorf("codec: zstd decoder not initialised")
+		}
+		out, err := c.zdec.DecodeAll(data, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, fmt.Errorf("%w: decompressed job exceeds %d bytes", ErrMalformed, c.maxDecoded)
+		}
+		return out, err
+	default:
+		return nil, fmt.Errorf("codec: unsupported compression %q", env.Compression)
+	}
+}
+
+func (c *Codec) compress(data []byte) ([]byte, error) {
+	switch c.compression {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, fmt.Errorf("codec: gzip: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("codec: gzip: %w", err)
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		return c.zenc.EncodeAll(data, nil), nil
+	default:
+		return data, nil
+	}
+}
+
+// sign computes the HMAC-SHA256 of the envelope header and data.
+func (e Envelope) sign(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(e.additionalData())
+	mac.Write([]byte{'|'})
+	mac.Write(e.Data)
+	return mac.Sum(nil)
+}
+
+// additionalData binds the ciphertext to the envelope header so the compression
+// or key ID cannot be swapped without failing authentication.
+func (e Envelope) additionalData() []byte {
+	return []byte(fmt.Sprintf("v%d|%s|%s", e.Version, e.Compression, e.KeyID))
+}
@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKeyring(t *testing.T) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, "k1")
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return k
+}
+
+func newTestCodec(t *testing.T, opts CodecOptions) *Codec {
+	t.Helper()
+	c, err := NewCodec(opts)
+	if err != nil {
+		t.Fatalf("NewCodec(%+v): %v", opts, err)
+	}
+	return c
+}
+
+// TestCodecRoundTrip checks that every codec setting decodes what it encodes.
+func TestCodecRoundTrip(t *testing.T) {
+	key := []byte("signing-key")
+	tests := []struct {
+		name string
+		opts CodecOptions
+	}{
+		{name: "plain", opts: CodecOptions{}},
+		{name: "gzip", opts: CodecOptions{Compression: CompressionGzip}},
+		{name: "zstd", opts: CodecOptions{Compression: CompressionZstd}},
+		{name: "encrypted", opts: CodecOptions{Keyring: testKeyring(t)}},
+		{name: "signed", opts: CodecOptions{SigningKey: key}},
+		{name: "zstd, encrypted and signed", opts: CodecOptions{Compression: CompressionZstd, Keyring: testKeyring(t), SigningKey: key, Strict: true}},
+	}
+	job := Job{ID: "job-1", Type: "report", Payload: strings.Repeat("payload ", 64), RequestID: "req-1", Tenant: "team-a"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCodec(t, tt.opts)
+			raw, err := c.Encode(job)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			got, err := c.Decode(raw)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if got != job {
+				t.Errorf("Decode = %+v, want %+v", got, job)
+			}
+		})
+	}
+}
+
+// TestCodecDecodeRejects checks how signing, strict mode and the legacy
+// fallback treat entries that are not validly signed envelopes.
+func TestCodecDecodeRejects(t *testing.T) {
+	key := []byte("signing-key")
+	signed := newTestCodec(t, CodecOptions{SigningKey: key})
+	job := Job{ID: "job-1", Payload: "hello", RequestID: "req-1"}
+
+	plainJSON, _ := json.Marshal(job)
+	envelope, err := signed.Encode(job)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	var env Envelope
+	if err := json.Unmarshal(envelope, &env); err != nil {
+		t.Fatalf("unmarshal envelope: %v", err)
+	}
+	env.Data = []byte(`{"id":"forged","payload":"rm -rf"}`)
+	tampered, _ := json.Marshal(env)
+	env.Signature = nil
+	unsignedEnvelope, _ := json.Marshal(env)
+
+	tests := []struct {
+		name    string
+		codec   *Codec
+		raw     []byte
+		wantErr error
+		wantID  string
+	}{
+		{name: "legacy raw entry", codec: newTestCodec(t, CodecOptions{}), raw: []byte("hello"), wantID: LegacyJobID},
+		{name: "legacy raw entry, nil codec", codec: nil, raw: []byte("hello"), wantID: LegacyJobID},
+		{name: "plain JSON job", codec: newTestCodec(t, CodecOptions{}), raw: plainJSON, wantID: "job-1"},
+		{name: "raw entry in strict mode", codec: newTestCodec(t, CodecOptions{Strict: true}), raw: []byte("hello"), wantErr: ErrMalformed},
+		{name: "legacy raw entry with signing", codec: signed, raw: []byte("hello"), wantErr: ErrUnsigned},
+		{name: "plain JSON job with signing", codec: signed, raw: plainJSON, wantErr: ErrUnsigned},
+		{name: "envelope without signature", codec: signed, raw: unsignedEnvelope, wantErr: ErrUnsigned},
+		{name: "tampered envelope", codec: signed, raw: tampered, wantErr: ErrBadSignature},
+		{name: "wrong signing key", codec: newTestCodec(t, CodecOptions{SigningKey: []byte("other")}), raw: envelope, wantErr: ErrBadSignature},
+		{name: "signed envelope", codec: signed, raw: envelope, wantID: "job-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.codec.Decode(tt.raw)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if got.ID != tt.wantID {
+				t.Errorf("Decode ID = %q, want %q", got.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+// TestCodecMaxDecodedSize checks that compressed entries cannot expand past the limit.
+func TestCodecMaxDecodedSize(t *testing.T) {
+	job := Job{ID: "bomb", Payload: strings.Repeat("a", 64<<10)}
+	tests := []struct {
+		name    string
+		comp    string
+		limit   int64
+		wantErr error
+	}{
+		{name: "gzip over limit", comp: CompressionGzip, limit: 4 << 10, wantErr: ErrMalformed},
+		{name: "zstd over limit", comp: CompressionZstd, limit: 4 << 10, wantErr: ErrMalformed},
+		{name: "gzip within limit", comp: CompressionGzip, limit: 1 << 20},
+		{name: "zstd within limit", comp: CompressionZstd, limit: 1 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := newTestCodec(t, CodecOptions{Compression: tt.comp}).Encode(job)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			_, err = newTestCodec(t, CodecOptions{MaxDecodedSize: tt.limit}).Decode(raw)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decode error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Job states. Queued jobs can still be cancelled; the last three are terminal.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// JobStatusTTL is how long a job's status is kept in Redis after its last update.
+const JobStatusTTL = 7 * 24 * time.Hour
+
+// maxJobStatusTxRetries bounds optimistic-lock retries on concurrent status updates.
+const maxJobStatusTxRetries = 10
+
+var (
+	// ErrJobNotFound is returned when no status exists for the given job ID.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobNotCancellable is returned when cancelling a job that already started.
+	ErrJobNotCancellable = errors.New("job already started")
+)
+
+// JobStatus is the externally visible state of a submitted job. Workflow step
+// jobs have none; their state lives in the workflow.
+type JobStatus struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type,omitempty"`
+	Priority   string    `json:"priority,omitempty"`
+	Status     string    `json:"status"`
+	Tenant     string    `json:"tenant,omitempty"`
+	Principal  string    `json:"principal,omitempty"`
+	RequestID  string    `json:"request_id"`
+	Error      string    `json:"error,omitempty"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Finished reports whether the job reached a terminal state.
+func (s *JobStatus) Finished() bool {
+	switch s.Status {
+	case JobSucceeded, JobFailed, JobCancelled:
+		return true
+	}
+	return false
+}
+
+// JobStatusKey returns the Redis key holding a job's status, in the tenant's namespace.
+func JobStatusKey(tenant, id string) string {
+	return TenantKey(tenant, "job:"+id)
+}
+
+func newJobStatus(job Job) JobStatus {
+	return JobStatus{
+		ID:         job.ID,
+		Type:       job.Type,
+		Priority:   job.Priority,
+		Status:     JobQueued,
+		Tenant:     NormalizeTenant(job.Tenant),
+		Principal:  job.Principal,
+		RequestID:  job.RequestID,
+		EnqueuedAt: job.EnqueuedAt,
+		UpdatedAt:  job.EnqueuedAt,
+	}
+}
+
+// GetJob loads a job's status. Jobs of other tenants are not found.
+func (p *Producer) GetJob(ctx context.Context, tenant, id string) (*JobStatus, error) {
+	return LoadJobStatus(ctx, p.client, tenant, id)
+}
+
+// CancelJob marks a queued job as cancelled; the worker drops it when it is
+// dequeued. Jobs that already started return ErrJobNotCancellable.
+func (p *Producer) CancelJob(ctx context.Context, tenant, id string) (*JobStatus, error) {
+	return updateJobStatus(ctx, p.client, tenant, id, func(s *JobStatus) error {
+		if s.Status != JobQueued {
+			return ErrJobNotCancellable
+		}
+		s.Status = JobCancelled
+		return nil
+	})
+}
+
+// LoadJobStatus reads a job's status using any redis command client (including a *redis.Tx).
+func LoadJobStatus(ctx context.Context, rdb redis.Cmdable, tenant, id string) (*JobStatus, error) {
+	data, err := rdb.Get(ctx, JobStatusKey(tenant, id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s JobStatus
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("decode job %s: %w", id, err)
+	}
+	return &s, nil
+}
+
+// StartJob moves a job from queued to running. It returns false when the job
+// was cancelled and must not run. Jobs without a status (workflow steps,
+// legacy entries) always run.
+func StartJob(ctx context.Context, rdb *redis.Client, job Job) (bool, error) {
+	cancelled := false
+	_, err := updateJobStatus(ctx, rdb, job.Tenant, job.ID, func(s *JobStatus) error {
+		cancelled = s.Status == JobCancelled
+		if s.Status != JobQueued {
+			return errJobUnchanged
+		}
+		s.Status = JobRunning
+		return nil
+	})
+	if errors.Is(err, ErrJobNotFound) || errors.Is(err, errJobUnchanged) {
+		err = nil
+	}
+	return !cancelled, err
+}
+
+// FinishJob records the outcome of a job that ran.
+func FinishJob(ctx context.Context, rdb *redis.Client, job Job, jobErr error) error {
+	_, err := updateJobStatus(ctx, rdb, job.Tenant, job.ID, func(s *JobStatus) error {
+		if jobErr != nil {
+			s.Status, s.Error = JobFailed, jobErr.Error()
+		} else {
+			s.Status, s.Error = JobSucceeded, ""
+		}
+		return nil
+	})
+	if errors.Is(err, ErrJobNotFound) {
+		return nil
+	}
+	return err
+}
+
+// errJobUnchanged aborts an update without writing.
+var errJobUnchanged = errors.New("job status unchanged")
+
+// updateJobStatus applies fn to a job's status under WATCH, so a cancel and
+// the worker picking the job up cannot both succeed.
+func updateJobStatus(ctx context.Context, rdb *redis.Client, tenant, id string, fn func(*JobStatus) error) (*JobStatus, error) {
+	key := JobStatusKey(tenant, id)
+	var status *JobStatus
+	txf := func(tx *redis.Tx) error {
+		s, err := LoadJobStatus(ctx, tx, tenant, id)
+		if err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			status = s
+			return err
+		}
+		s.UpdatedAt = time.Now().UTC()
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, JobStatusTTL)
+			return nil
+		})
+		status = s
+		return err
+	}
+
+	var err error
+	for i := 0; i < maxJobStatusTxRetries; i++ {
+		err = rdb.Watch(ctx, txf, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	return status, err
+}
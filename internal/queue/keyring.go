@@ -0,0 +1,154 @@
+package queue
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Keyring holds the AES-GCM keys used to encrypt job payloads at rest.
+// New payloads are always sealed with the active key; every other key is
+// kept only so jobs enqueued before a rotation can still be opened.
+type Keyring struct {
+	activeID string
+	aeads    map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from raw AES keys (16, 24 or 32 bytes) indexed by key ID.
+// activeID may be empty when exactly one key is supplied.
+func NewKeyring(keys map[string][]byte, activeID string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("keyring: no keys supplied")
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("keyring: key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("keyring: key %q: %w", id, err)
+		}
+		aeads[id] = aead
+	}
+
+	if activeID == "" {
+		if len(keys) > 1 {
+			return nil, fmt.Errorf("keyring: %d keys loaded but no active key ID configured", len(keys))
+		}
+		for id := range keys {
+			activeID = id
+		}
+	}
+	if _, ok := aeads[activeID]; !ok {
+		return nil, fmt.Errorf("keyring: active key %q not found", activeID)
+	}
+
+	return &Keyring{activeID: activeID, aeads: aeads}, nil
+}
+
+// LoadKeyring collects keys from an inline spec ("id1:base64,id2:base64") and
+// from a directory of mounted files (file name = key ID, content = base64 key),
+// which is how a Kubernetes Secret volume lays them out.
+// It returns nil when neither source provides any key.
+func LoadKeyring(spec, dir, activeID string) (*Keyring, error) {
+	keys := make(map[string][]byte)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("keyring: malformed key entry (want id:base64)")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("keyring: key %q is not valid base64: %w", id, err)
+		}
+		keys[id] = key
+	}
+
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("keyring: read key dir: %w", err)
+		}
+		for _, e := range entries {
+			// Skip the ..data / ..timestamp entries created by Secret volume mounts.
+			if strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			info, err := os.Stat(path)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("keyring: read key %q: %w", e.Name(), err)
+			}
+			key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+			if err != nil {
+				return nil, fmt.Errorf("keyring: key %q is not valid base64: %w", e.Name(), err)
+			}
+			keys[e.Name()] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return NewKeyring(keys, activeID)
+}
+
+// ActiveKeyID returns the ID of the key used for new payloads.
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// KeyIDs returns all loaded key IDs in sorted order.
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.aeads))
+	for id := range k.aeads {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Seal encrypts plaintext with the active key. The random nonce is prepended to the ciphertext.
+func (k *Keyring) Seal(plaintext, additionalData []byte) (string, []byte, error) {
+	aead := k.aeads[k.activeID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, fmt.Errorf("keyring: generate nonce: %w", err)
+	}
+	return k.activeID, aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts a ciphertext produced by Seal with the key identified by keyID.
+func (k *Keyring) Open(keyID string, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, ok := k.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("keyring: unknown key %q", keyID)
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("keyring: ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: decrypt with key %q: %w", keyID, err)
+	}
+	return plaintext, nil
+}
@@ -3,29 +3,87 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/go-redis/redis/extra/redisotel/v8"
 	"github.com/go-redis/redis/v8"
+	"github.com/sanjeevsethi/sre-platform-app/internal/logger"
 	"github.com/sony/gobreaker"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
 )
 
+// log is the queue module logger; its level can be changed at runtime.
+var log = logger.Module(logger.ModuleQueue)
+
+// JobsKey is the Redis list jobs are pushed to and consumed from.
+const JobsKey = "jobs"
+
 type Job struct {
 	ID          string `json:"id"`
+	Type        string `json:"type,omitempty"`
 	Payload     string `json:"payload"`
 	RequestID   string `json:"request_id"`
 	TraceParent string `json:"trace_parent,omitempty"`
+	// Set when the job executes a workflow step.
+	WorkflowID string `json:"workflow_id,omitempty"`
+	StepID     string `json:"step_id,omitempty"`
+	// Priority is one of PriorityHigh, PriorityNormal or PriorityLow.
+	Priority string `json:"priority,omitempty"`
+	// Principal is the authenticated caller that submitted the job.
+	Principal string `json:"principal,omitempty"`
+	// Tenant owns the job; empty means DefaultTenant.
+	Tenant     string    `json:"tenant,omitempty"`
+	EnqueuedAt time.Time `json:"enqueued_at,omitempty"`
+}
+
+// Job priorities, used by admission control to decide what to shed first.
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// PriorityRank orders priorities; unknown values rank as normal.
+func PriorityRank(priority string) int {
+	switch priority {
+	case PriorityLow:
+		return 0
+	case PriorityHigh:
+		return 2
+	default:
+		return 1
+	}
 }
 
 type Producer struct {
 	client *redis.Client
 	cb     *gobreaker.CircuitBreaker
+	codec  *Codec
+	spool  *Spool
+}
+
+// ProducerOption customises a Producer.
+type ProducerOption func(*Producer)
+
+// WithCodec sets the codec used to encode jobs before they are pushed to Redis.
+func WithCodec(c *Codec) ProducerOption {
+	return func(p *Producer) {
+		p.codec = c
+	}
+}
+
+// WithSpool enables the local outbox: jobs that cannot be pushed to Redis are
+// written to the spool and relayed later by RunRelay.
+func WithSpool(s *Spool) ProducerOption {
+	return func(p *Producer) {
+		p.spool = s
+	}
 }
 
-func NewProducer(addr string) *Producer {
+func NewProducer(addr string, opts ...ProducerOption) *Producer {
 	rdb := redis.NewClient(&redis.Options{
 		Addr: addr,
 	})
@@ -44,31 +102,122 @@ func NewProducer(addr string) *Producer {
 	}
 	cb := gobreaker.NewCircuitBreaker(st)
 
-	return &Producer{
+	p := &Producer{
 		client: rdb,
 		cb:     cb,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 func (p *Producer) Enqueue(ctx context.Context, job Job) error {
 	// Inject trace context into job
-	carrier := propagation.MapCarrier{}
-	otel.GetTextMapPropagator().Inject(ctx, carrier)
-	job.TraceParent = carrier.Get("traceparent")
+	injectTraceContext(ctx, &job)
+	if job.EnqueuedAt.IsZero() {
+		job.EnqueuedAt = time.Now().UTC()
+	}
 
-	_, err := p.cb.Execute(func() (interface{}, error) {
-		data, err := json.Marshal(job)
-		if err != nil {
-			return nil, err
-		}
-		return p.client.LPush(ctx, "jobs", data).Result()
-	})
+	data, err := p.codec.Encode(job)
 	if err != nil {
 		return fmt.Errorf("enqueue failed: %w", err)
 	}
+	// The status is written with the job so GetJob never misses a queued job.
+	status, err := json.Marshal(newJobStatus(job))
+	if err != nil {
+		return fmt.Errorf("enqueue failed: %w", err)
+	}
+
+	key := TenantJobsKey(job.Tenant)
+	statusKey := JobStatusKey(job.Tenant, job.ID)
+	_, err = p.cb.Execute(func() (interface{}, error) {
+		return p.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, statusKey, status, JobStatusTTL)
+			pipe.LPush(ctx, key, data)
+			pipe.SAdd(ctx, TenantsKey, NormalizeTenant(job.Tenant))
+			return nil
+		})
+	})
+	if err == nil {
+		return nil
+	}
+	// Only an unavailable Redis (or open breaker) is spooled; a cancelled or
+	// timed-out request is not answered, so its job must not be queued later.
+	if p.spool == nil || ctx.Err() != nil {
+		return fmt.Errorf("enqueue failed: %w", err)
+	}
+
+	// Redis is unavailable (or the breaker is open): fall back to the local spool.
+	spoolErr := p.spool.Append(SpoolRecord{Queue: key, Tenant: NormalizeTenant(job.Tenant), Data: data, StatusKey: statusKey, Status: status, EnqueuedAt: time.Now().UTC()})
+	if spoolErr != nil {
+		if errors.Is(spoolErr, ErrSpoolFull) {
+			spoolRejectedTotal.Inc()
+		}
+		return fmt.Errorf("enqueue failed: %w (spool: %w)", err, spoolErr)
+	}
+	spoolAppendedTotal.Inc()
+	p.updateSpoolMetrics()
+	log.Warn().Err(err).Str("job_id", job.ID).Msg("Redis unavailable, job spooled locally")
 	return nil
 }
 
+// Backlog returns the total length of all tenant queues and the age of the
+// oldest job among them. The age is zero when the queues are empty or the
+// oldest entries carry no timestamp.
+func (p *Producer) Backlog(ctx context.Context) (int64, time.Duration, error) {
+	backlogs, err := p.TenantBacklogs(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	var total Backlog
+	for _, b := range backlogs {
+		total.Depth += b.Depth
+		if b.OldestAge > total.OldestAge {
+			total.OldestAge = b.OldestAge
+		}
+	}
+	return total.Depth, total.OldestAge, nil
+}
+
+func (p *Producer) queueBacklog(ctx context.Context, key string) (Backlog, error) {
+	depth, err := p.client.LLen(ctx, key).Result()
+	if err != nil || depth == 0 {
+		return Backlog{Depth: depth}, err
+	}
+
+	// Jobs are LPUSHed and BRPOPed, so the oldest one sits at the tail.
+	raw, err := p.client.LIndex(ctx, key, -1).Bytes()
+	if err == redis.Nil {
+		return Backlog{}, nil
+	}
+	if err != nil {
+		return Backlog{Depth: depth}, err
+	}
+	oldest, err := p.codec.Decode(raw)
+	if err != nil || oldest.EnqueuedAt.IsZero() {
+		return Backlog{Depth: depth}, nil
+	}
+	return Backlog{Depth: depth, OldestAge: time.Since(oldest.EnqueuedAt)}, nil
+}
+
+// injectTraceContext stamps the W3C traceparent of ctx onto the job.
+func injectTraceContext(ctx context.Context, job *Job) {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	job.TraceParent = carrier.Get("traceparent")
+}
+
+// Ping checks that Redis is reachable.
+func (p *Producer) Ping(ctx context.Context) error {
+	return p.client.Ping(ctx).Err()
+}
+
+// Spooling reports whether jobs are spooled locally while Redis is unavailable.
+func (p *Producer) Spooling() bool {
+	return p.spool != nil
+}
+
 func (p *Producer) Close() error {
 	return p.client.Close()
 }
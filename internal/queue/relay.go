@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sony/gobreaker"
+)
+
+// Spool metrics
+var (
+	spoolDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "queue_spool_depth",
+			Help: "Number of jobs waiting in the local spool to be relayed to Redis.",
+		},
+	)
+	spoolBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "queue_spool_bytes",
+			Help: "Size in bytes of the jobs waiting in the local spool.",
+		},
+	)
+	spoolOldestAge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "queue_spool_oldest_age_seconds",
+			Help: "Age of the oldest job waiting in the local spool.",
+		},
+	)
+	spoolAppendedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "queue_spool_appended_total",
+			Help: "Total number of jobs written to the local spool because Redis was unavailable.",
+		},
+	)
+	spoolRejectedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "queue_spool_rejected_total",
+			Help: "Total number of jobs rejected because the local spool was full.",
+		},
+	)
+	spoolRelayedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "queue_spool_relayed_total",
+			Help: "Total number of spooled jobs relayed to Redis.",
+		},
+	)
+)
+
+// RunRelay drains the spool into Redis until ctx is done. It only attempts a
+// drain while the circuit breaker is not open, so a dead Redis is not hammered.
+// Once ctx is done it makes a final drain bounded by finalDrain, so jobs that
+// were already accepted are not left behind when the pod goes away.
+func (p *Producer) RunRelay(ctx context.Context, interval, finalDrain time.Duration) {
+	if p.spool == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			p.finalDrain(finalDrain)
+			return
+		case <-ticker.C:
+		}
+
+		depth, _, _ := p.spool.Stats()
+		if depth > 0 && p.cb.State() != gobreaker.StateOpen {
+			if err := p.relay(ctx); err != nil && ctx.Err() == nil {
+				log.Warn().Err(err).Msg("Spool relay paused")
+			}
+		}
+
+		p.updateSpoolMetrics()
+	}
+}
+
+// finalDrain relays what is left in the spool before shutdown. Jobs it cannot
+// relay stay on disk for the next process using the same spool directory.
+func (p *Producer) finalDrain(timeout time.Duration) {
+	defer p.updateSpoolMetrics()
+	if depth, _, _ := p.spool.Stats(); depth == 0 || timeout <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := p.relay(ctx); err != nil {
+		depth, _, _ := p.spool.Stats()
+		log.Error().Err(err).Int("remaining", depth).Msg("Spool not fully relayed before shutdown")
+	}
+}
+
+// relay pushes spooled jobs to Redis in order until the spool is empty or a
+// push fails. Spool.Drain is not safe for concurrent use, so relay must only
+// be called from RunRelay.
+func (p *Producer) relay(ctx context.Context) error {
+	n, err := p.spool.Drain(ctx, func(rec SpoolRecord) error {
+		_, err := p.cb.Execute(func() (interface{}, error) {
+			return p.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				if rec.StatusKey != "" {
+					pipe.SetNX(ctx, rec.StatusKey, rec.Status, JobStatusTTL)
+				}
+				pipe.LPush(ctx, rec.Queue, rec.Data)
+				if rec.Tenant != "" {
+					pipe.SAdd(ctx, TenantsKey, rec.Tenant)
+				}
+				return nil
+			})
+		})
+		return err
+	})
+	spoolRelayedTotal.Add(float64(n))
+	if n > 0 {
+		log.Info().Int("relayed", n).Msg("Relayed spooled jobs to Redis")
+	}
+	return err
+}
+
+func (p *Producer) updateSpoolMetrics() {
+	depth, size, age := p.spool.Stats()
+	spoolDepth.Set(float64(depth))
+	spoolBytes.Set(float64(size))
+	spoolOldestAge.Set(age.Seconds())
+}
@@ -0,0 +1,248 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSpoolFull is returned when accepting a job would exceed the spool's size bounds.
+// The spool never drops or overwrites entries it has already accepted; new jobs are rejected instead.
+var ErrSpoolFull = errors.New("spool full")
+
+const (
+	spoolLogFile    = "spool.log"
+	spoolOffsetFile = "spool.offset"
+)
+
+// SpoolRecord is one job waiting in the spool, already encoded for Redis.
+type SpoolRecord struct {
+	Queue  string `json:"queue"`
+	Tenant string `json:"tenant,omitempty"`
+	Data   []byte `json:"data"`
+	// StatusKey and Status restore the job's status when it is relayed.
+	StatusKey  string    `json:"status_key,omitempty"`
+	Status     []byte    `json:"status,omitempty"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+}
+
+// Spool is a durable, file-based append-only log of jobs that could not be
+// pushed to Redis. Records are appended as JSON lines and fsynced; a separate
+// offset file tracks how far the relay has drained. Once everything has been
+// relayed the log is truncated. Delivery is at-least-once: a crash between an
+// LPUSH and the offset update replays that record.
+type Spool struct {
+	mu         sync.Mutex
+	dir        string
+	maxBytes   int64
+	maxEntries int
+
+	log    *os.File
+	size   int64 // bytes in the log file
+	offset int64 // bytes already relayed
+	// Enqueue times of pending records, oldest first.
+	pending []time.Time
+}
+
+// OpenSpool opens (or creates) the spool in dir and recovers any pending records.
+// maxBytes and maxEntries bound the pending (not yet relayed) data.
+func OpenSpool(dir string, maxBytes int64, maxEntries int) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("spool: create dir: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, spoolLogFile), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("spool: open log: %w", err)
+	}
+
+	s := &Spool{dir: dir, maxBytes: maxBytes, maxEntries: maxEntries, log: f}
+	if err := s.recover(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// recover loads the relay offset and rebuilds the pending index. A torn final
+// line (crash during append) is truncated away.
+func (s *Spool) recover() error {
+	raw, err := os.ReadFile(filepath.Join(s.dir, spoolOffsetFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("spool: read offset: %w", err)
+	}
+	if len(raw) > 0 {
+		if s.offset, err = strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64); err != nil {
+			return fmt.Errorf("spool: corrupt offset file: %w", err)
+		}
+	}
+
+	info, err := s.log.Stat()
+	if err != nil {
+		return fmt.Errorf("spool: stat log: %w", err)
+	}
+	if s.offset > info.Size() {
+		// compact truncates the log before resetting the offset; a crash in
+		// between leaves the offset past the end of a log that was fully drained.
+		if err := s.commitOffset(0); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.log.Seek(s.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("spool: seek: %w", err)
+	}
+	pos := s.offset
+	r := bufio.NewReader(s.log)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("spool: scan: %w", err)
+		}
+		var rec SpoolRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("spool: corrupt record at offset %d: %w", pos, err)
+		}
+		s.pending = append(s.pending, rec.EnqueuedAt)
+		pos += int64(len(line))
+	}
+
+	if err := s.log.Truncate(pos); err != nil {
+		return fmt.Errorf("spool: truncate torn record: %w", err)
+	}
+	s.size = pos
+	return nil
+}
+
+// Append durably stores a record. It returns ErrSpoolFull when the bounds would be exceeded.
+func (s *Spool) Append(rec SpoolRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) >= s.maxEntries || s.size-s.offset+int64(len(line)) > s.maxBytes {
+		return ErrSpoolFull
+	}
+	if _, err := s.log.Write(line); err != nil {
+		return fmt.Errorf("spool: append: %w", err)
+	}
+	if err := s.log.Sync(); err != nil {
+		return fmt.Errorf("spool: fsync: %w", err)
+	}
+	s.size += int64(len(line))
+	s.pending = append(s.pending, rec.EnqueuedAt)
+	return nil
+}
+
+// Drain hands pending records to push in order, advancing the offset after each
+// success. It stops at the first push error and returns how many records were relayed.
+// Drain must not be called concurrently; the lock is released while push runs so
+// Append is never blocked on Redis.
+func (s *Spool) Drain(ctx context.Context, push func(SpoolRecord) error) (int, error) {
+	relayed := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return relayed, err
+		}
+
+		s.mu.Lock()
+		if s.offset >= s.size {
+			// Fully drained: compact the log so it does not grow forever.
+			err := s.compact()
+			s.mu.Unlock()
+			return relayed, err
+		}
+		off := s.offset
+		line, err := s.readLineAt(off)
+		s.mu.Unlock()
+		if err != nil {
+			return relayed, err
+		}
+
+		var rec SpoolRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return relayed, fmt.Errorf("spool: corrupt record at offset %d: %w", off, err)
+		}
+		if err := push(rec); err != nil {
+			return relayed, err
+		}
+
+		s.mu.Lock()
+		err = s.commitOffset(off + int64(len(line)))
+		if err == nil {
+			s.pending = s.pending[1:]
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return relayed, err
+		}
+		relayed++
+	}
+}
+
+func (s *Spool) compact() error {
+	if s.size == 0 {
+		return nil
+	}
+	if err := s.log.Truncate(0); err != nil {
+		return fmt.Errorf("spool: compact: %w", err)
+	}
+	s.size = 0
+	return s.commitOffset(0)
+}
+
+func (s *Spool) readLineAt(off int64) ([]byte, error) {
+	r := bufio.NewReader(io.NewSectionReader(s.log, off, s.size-off))
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("spool: read record at offset %d: %w", off, err)
+	}
+	return line, nil
+}
+
+// commitOffset persists the relay offset with a write-then-rename so it is never torn.
+func (s *Spool) commitOffset(off int64) error {
+	tmp := filepath.Join(s.dir, spoolOffsetFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(off, 10)), 0o640); err != nil {
+		return fmt.Errorf("spool: write offset: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, spoolOffsetFile)); err != nil {
+		return fmt.Errorf("spool: commit offset: %w", err)
+	}
+	s.offset = off
+	return nil
+}
+
+// Stats returns the number of pending records, their size in bytes and the age of the oldest one.
+func (s *Spool) Stats() (depth int, size int64, oldestAge time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) > 0 {
+		oldestAge = time.Since(s.pending[0])
+	}
+	return len(s.pending), s.size - s.offset, oldestAge
+}
+
+// Close closes the underlying log file.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.log.Close()
+}
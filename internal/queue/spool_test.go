@@ -0,0 +1,191 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openTestSpool(t *testing.T, dir string) *Spool {
+	t.Helper()
+	s, err := OpenSpool(dir, 1<<20, 100)
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	return s
+}
+
+func appendRecords(t *testing.T, s *Spool, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		if err := s.Append(SpoolRecord{Queue: "jobs", Data: []byte(id), EnqueuedAt: time.Now()}); err != nil {
+			t.Fatalf("Append(%q): %v", id, err)
+		}
+	}
+}
+
+// drainIDs relays up to limit records (all when limit is 0) and returns their data.
+func drainIDs(t *testing.T, s *Spool, limit int) []string {
+	t.Helper()
+	stop := errors.New("stop")
+	var ids []string
+	_, err := s.Drain(context.Background(), func(rec SpoolRecord) error {
+		if limit > 0 && len(ids) == limit {
+			return stop
+		}
+		ids = append(ids, string(rec.Data))
+		return nil
+	})
+	if err != nil && !errors.Is(err, stop) {
+		t.Fatalf("Drain: %v", err)
+	}
+	return ids
+}
+
+// TestSpoolRecovery reopens a spool after a clean close or a simulated crash
+// and checks which records are still relayed.
+func TestSpoolRecovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, dir string)
+		wantIDs []string
+		wantErr bool
+	}{
+		{
+			name: "pending records survive a restart",
+			setup: func(t *testing.T, dir string) {
+				s := openTestSpool(t, dir)
+				appendRecords(t, s, "a", "b", "c")
+				s.Close()
+			},
+			wantIDs: []string{"a", "b", "c"},
+		},
+		{
+			name: "relayed records are not replayed",
+			setup: func(t *testing.T, dir string) {
+				s := openTestSpool(t, dir)
+				appendRecords(t, s, "a", "b", "c")
+				if got := drainIDs(t, s, 2); !reflect.DeepEqual(got, []string{"a", "b"}) {
+					t.Fatalf("partial drain = %v", got)
+				}
+				s.Close()
+			},
+			wantIDs: []string{"c"},
+		},
+		{
+			name: "torn tail is truncated",
+			setup: func(t *testing.T, dir string) {
+				s := openTestSpool(t, dir)
+				appendRecords(t, s, "a", "b")
+				s.Close()
+				f, err := os.OpenFile(filepath.Join(dir, spoolLogFile), os.O_APPEND|os.O_WRONLY, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.WriteString(`{"queue":"jobs","data":"dG9y`)
+				f.Close()
+			},
+			wantIDs: []string{"a", "b"},
+		},
+		{
+			name: "offset past a compacted log is reset",
+			setup: func(t *testing.T, dir string) {
+				s := openTestSpool(t, dir)
+				s.Close()
+				if err := os.WriteFile(filepath.Join(dir, spoolOffsetFile), []byte("4096"), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "corrupt offset file",
+			setup: func(t *testing.T, dir string) {
+				if err := os.WriteFile(filepath.Join(dir, spoolOffsetFile), []byte("not-a-number"), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "corrupt record before the tail",
+			setup: func(t *testing.T, dir string) {
+				if err := os.WriteFile(filepath.Join(dir, spoolLogFile), []byte("garbage\n"), 0o640); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+
+			s, err := OpenSpool(dir, 1<<20, 100)
+			if tt.wantErr {
+				if err == nil {
+					s.Close()
+					t.Fatal("OpenSpool succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenSpool: %v", err)
+			}
+			defer s.Close()
+
+			if depth, _, _ := s.Stats(); depth != len(tt.wantIDs) {
+				t.Errorf("depth after recovery = %d, want %d", depth, len(tt.wantIDs))
+			}
+			// New records go after the recovered ones, never into a torn line.
+			appendRecords(t, s, "new")
+			want := append(append([]string{}, tt.wantIDs...), "new")
+			if got := drainIDs(t, s, 0); !reflect.DeepEqual(got, want) {
+				t.Errorf("drained %v, want %v", got, want)
+			}
+			if depth, size, _ := s.Stats(); depth != 0 || size != 0 {
+				t.Errorf("after drain depth = %d, size = %d, want 0, 0", depth, size)
+			}
+		})
+	}
+}
+
+// TestSpoolFull checks that the entry and byte bounds reject new records.
+func TestSpoolFull(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBytes   int64
+		maxEntries int
+		appends    int
+		wantErrAt  int
+	}{
+		{name: "entry limit", maxBytes: 1 << 20, maxEntries: 2, appends: 3, wantErrAt: 2},
+		{name: "byte limit", maxBytes: 150, maxEntries: 100, appends: 3, wantErrAt: 1},
+		{name: "within limits", maxBytes: 1 << 20, maxEntries: 100, appends: 3, wantErrAt: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := OpenSpool(t.TempDir(), tt.maxBytes, tt.maxEntries)
+			if err != nil {
+				t.Fatalf("OpenSpool: %v", err)
+			}
+			defer s.Close()
+			for i := 0; i < tt.appends; i++ {
+				err := s.Append(SpoolRecord{Queue: "jobs", Data: []byte("0123456789"), EnqueuedAt: time.Now()})
+				if i == tt.wantErrAt {
+					if !errors.Is(err, ErrSpoolFull) {
+						t.Fatalf("Append #%d = %v, want ErrSpoolFull", i, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Append #%d: %v", i, err)
+				}
+			}
+		})
+	}
+}
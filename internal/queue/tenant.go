@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultTenant owns jobs submitted without a tenant. It keeps the
+// unprefixed Redis keys, so single-tenant deployments are unaffected.
+const DefaultTenant = "default"
+
+// TenantsKey is the Redis set of tenants that have ever enqueued a job.
+const TenantsKey = "tenants"
+
+// OtherTenantLabel replaces tenant names once the metric label limit is reached.
+const OtherTenantLabel = "other"
+
+var tenantNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidTenant reports whether name is safe to embed in Redis keys and metric labels.
+func ValidTenant(name string) bool {
+	return tenantNameRe.MatchString(name)
+}
+
+// NormalizeTenant maps an empty tenant to DefaultTenant.
+func NormalizeTenant(tenant string) string {
+	if tenant == "" {
+		return DefaultTenant
+	}
+	return tenant
+}
+
+// TenantKey namespaces a Redis key for tenant, e.g. "tenant:team-a:jobs".
+func TenantKey(tenant, key string) string {
+	tenant = NormalizeTenant(tenant)
+	if tenant == DefaultTenant {
+		return key
+	}
+	return "tenant:" + tenant + ":" + key
+}
+
+// TenantJobsKey returns the queue a tenant's jobs are pushed to.
+func TenantJobsKey(tenant string) string {
+	return TenantKey(tenant, JobsKey)
+}
+
+// TenantOfJobsKey returns the tenant whose queue key is, the inverse of TenantJobsKey.
+func TenantOfJobsKey(key string) (string, bool) {
+	if key == JobsKey {
+		return DefaultTenant, true
+	}
+	rest, ok := strings.CutPrefix(key, "tenant:")
+	if !ok {
+		return "", false
+	}
+	tenant, ok := strings.CutSuffix(rest, ":"+JobsKey)
+	if !ok || !ValidTenant(tenant) {
+		return "", false
+	}
+	return tenant, true
+}
+
+// Tenants lists every tenant with a queue, DefaultTenant first.
+func Tenants(ctx context.Context, rdb redis.Cmdable) ([]string, error) {
+	members, err := rdb.SMembers(ctx, TenantsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(members)
+	out := []string{DefaultTenant}
+	for _, t := range members {
+		if t != DefaultTenant && ValidTenant(t) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// Backlog is the depth of one queue and the age of its oldest job.
+type Backlog struct {
+	Depth     int64
+	OldestAge time.Duration
+}
+
+// TenantBacklogs returns the backlog of every tenant queue.
+func (p *Producer) TenantBacklogs(ctx context.Context) (map[string]Backlog, error) {
+	tenants, err := Tenants(ctx, p.client)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]Backlog, len(tenants))
+	for _, t := range tenants {
+		b, err := p.queueBacklog(ctx, TenantJobsKey(t))
+		if err != nil {
+			return nil, fmt.Errorf("backlog of tenant %s: %w", t, err)
+		}
+		out[t] = b
+	}
+	return out, nil
+}
+
+// tenantLabels bounds the cardinality of tenant metric labels.
+var tenantLabels = &tenantLabeler{max: 20, seen: map[string]bool{DefaultTenant: true}}
+
+type tenantLabeler struct {
+	mu   sync.Mutex
+	max  int
+	seen map[string]bool
+}
+
+// ConfigureTenantLabels sets how many distinct tenants get their own metric
+// label; known tenants (e.g. those with quotas) are always labelled.
+func ConfigureTenantLabels(max int, known ...string) {
+	tenantLabels.mu.Lock()
+	defer tenantLabels.mu.Unlock()
+	tenantLabels.max = max
+	for _, t := range known {
+		tenantLabels.seen[t] = true
+	}
+}
+
+// TenantLabel returns the metric label for tenant: its name for the first
+// tenants seen, OtherTenantLabel after the limit is reached.
+func TenantLabel(tenant string) string {
+	tenant = NormalizeTenant(tenant)
+	l := tenantLabels
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen[tenant] {
+		return tenant
+	}
+	if len(l.seen) < l.max {
+		l.seen[tenant] = true
+		return tenant
+	}
+	return OtherTenantLabel
+}
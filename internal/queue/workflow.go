@@ -0,0 +1,300 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Step states.
+const (
+	StepPending   = "pending"
+	StepQueued    = "queued"
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped"
+)
+
+// Workflow states.
+const (
+	WorkflowRunning   = "running"
+	WorkflowSucceeded = "succeeded"
+	WorkflowFailed    = "failed"
+)
+
+// WorkflowTTL is how long a workflow's state is kept in Redis after its last update.
+const WorkflowTTL = 7 * 24 * time.Hour
+
+// ErrWorkflowNotFound is returned when no workflow exists for the given ID.
+var ErrWorkflowNotFound = errors.New("workflow not found")
+
+// Step is a single node of a workflow DAG. It runs as one Job once every step
+// in DependsOn has succeeded.
+type Step struct {
+	ID        string   `json:"id"`
+	Type      string   `json:"type,omitempty"`
+	Payload   string   `json:"payload"`
+	DependsOn []string `json:"depends_on,omitempty"`
+	Status    string   `json:"status"`
+	JobID     string   `json:"job_id,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Workflow is a DAG of steps together with its execution state.
+type Workflow struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Status    string    `json:"status"`
+	RequestID string    `json:"request_id"`
+	Principal string    `json:"principal,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Steps     []*Step   `json:"steps"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Lookup indexes over Steps, built on first use. Steps must not be added
+	// or rewired afterwards.
+	byID       map[string]*Step
+	dependents map[string][]*Step
+}
+
+// WorkflowKey returns the Redis key holding a workflow's state, in the tenant's namespace.
+func WorkflowKey(tenant, id string) string {
+	return TenantKey(tenant, "workflow:"+id)
+}
+
+// Validate checks that step IDs are unique, every dependency exists and the graph is acyclic.
+func (w *Workflow) Validate() error {
+	if len(w.Steps) == 0 {
+		return fmt.Errorf("workflow has no steps")
+	}
+
+	byID := make(map[string]*Step, len(w.Steps))
+	for _, s := range w.Steps {
+		if s.ID == "" {
+			return fmt.Errorf("step id is required")
+		}
+		if _, dup := byID[s.ID]; dup {
+			return fmt.Errorf("duplicate step id %q", s.ID)
+		}
+		byID[s.ID] = s
+	}
+
+	// Kahn's algorithm: if not every step can be ordered, there is a cycle.
+	inDegree := make(map[string]int, len(w.Steps))
+	dependents := make(map[string][]string)
+	for _, s := range w.Steps {
+		for _, dep := range s.DependsOn {
+			if _, ok := byID[dep]; !ok {
+				return fmt.Errorf("step %q depends on unknown step %q", s.ID, dep)
+			}
+			inDegree[s.ID]++
+			dependents[dep] = append(dependents[dep], s.ID)
+		}
+	}
+	var ready []string
+	for _, s := range w.Steps {
+		if inDegree[s.ID] == 0 {
+			ready = append(ready, s.ID)
+		}
+	}
+	visited := 0
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		visited++
+		for _, next := range dependents[id] {
+			inDegree[next]--
+			if inDegree[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+	if visited != len(w.Steps) {
+		return fmt.Errorf("workflow contains a dependency cycle")
+	}
+	return nil
+}
+
+// index builds the step lookup maps once, so completing a step does not scan
+// the whole workflow for every dependency.
+func (w *Workflow) index() {
+	if w.byID != nil {
+		return
+	}
+	w.byID = make(map[string]*Step, len(w.Steps))
+	w.dependents = make(map[string][]*Step)
+	for _, s := range w.Steps {
+		w.byID[s.ID] = s
+		for _, dep := range s.DependsOn {
+			w.dependents[dep] = append(w.dependents[dep], s)
+		}
+	}
+}
+
+// Step returns the step with the given ID, or nil.
+func (w *Workflow) Step(id string) *Step {
+	w.index()
+	return w.byID[id]
+}
+
+// Runnable returns the pending steps whose dependencies have all succeeded.
+func (w *Workflow) Runnable() []*Step {
+	var out []*Step
+	for _, s := range w.Steps {
+		if s.Status != StepPending {
+			continue
+		}
+		ready := true
+		for _, dep := range s.DependsOn {
+			if d := w.Step(dep); d == nil || d.Status != StepSucceeded {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Complete records the outcome of a step. On failure every step that
+// (transitively) depends on it is skipped. The workflow status is recomputed.
+// It reports false if the step was unknown or not in the queued state, which
+// happens when a job is delivered more than once.
+func (w *Workflow) Complete(stepID string, stepErr error) bool {
+	s := w.Step(stepID)
+	if s == nil || s.Status != StepQueued {
+		return false
+	}
+
+	if stepErr == nil {
+		s.Status = StepSucceeded
+	} else {
+		s.Status = StepFailed
+		s.Error = stepErr.Error()
+		w.skipDependents(stepID)
+	}
+	w.UpdatedAt = time.Now().UTC()
+	w.updateStatus()
+	return true
+}
+
+func (w *Workflow) skipDependents(stepID string) {
+	w.index()
+	for _, s := range w.dependents[stepID] {
+		if s.Status == StepPending {
+			s.Status = StepSkipped
+			w.skipDependents(s.ID)
+		}
+	}
+}
+
+func (w *Workflow) updateStatus() {
+	failed := false
+	for _, s := range w.Steps {
+		switch s.Status {
+		case StepPending, StepQueued:
+			return
+		case StepFailed, StepSkipped:
+			failed = true
+		}
+	}
+	if failed {
+		w.Status = WorkflowFailed
+	} else {
+		w.Status = WorkflowSucceeded
+	}
+}
+
+// NewStepJob marks a step as queued and returns the Job that executes it,
+// carrying the trace context of ctx.
+func NewStepJob(ctx context.Context, w *Workflow, s *Step) Job {
+	s.Status = StepQueued
+	s.JobID = uuid.New().String()
+
+	job := Job{
+		ID:         s.JobID,
+		Type:       s.Type,
+		Payload:    s.Payload,
+		RequestID:  w.RequestID,
+		Principal:  w.Principal,
+		Tenant:     w.Tenant,
+		WorkflowID: w.ID,
+		StepID:     s.ID,
+		EnqueuedAt: time.Now().UTC(),
+	}
+	injectTraceContext(ctx, &job)
+	return job
+}
+
+// SubmitWorkflow validates and stores a new workflow, then enqueues its root steps
+// in the same Redis transaction.
+func (p *Producer) SubmitWorkflow(ctx context.Context, w *Workflow) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	w.Status = WorkflowRunning
+	w.CreatedAt, w.UpdatedAt = now, now
+	for _, s := range w.Steps {
+		s.Status = StepPending
+	}
+
+	var payloads [][]byte
+	for _, s := range w.Runnable() {
+		data, err := p.codec.Encode(NewStepJob(ctx, w, s))
+		if err != nil {
+			return err
+		}
+		payloads = append(payloads, data)
+	}
+
+	state, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.cb.Execute(func() (interface{}, error) {
+		return p.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, WorkflowKey(w.Tenant, w.ID), state, WorkflowTTL)
+			for _, data := range payloads {
+				pipe.LPush(ctx, TenantJobsKey(w.Tenant), data)
+			}
+			pipe.SAdd(ctx, TenantsKey, NormalizeTenant(w.Tenant))
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("submit workflow failed: %w", err)
+	}
+	return nil
+}
+
+// GetWorkflow loads a workflow's current state. Workflows of other tenants are not found.
+func (p *Producer) GetWorkflow(ctx context.Context, tenant, id string) (*Workflow, error) {
+	return LoadWorkflow(ctx, p.client, tenant, id)
+}
+
+// LoadWorkflow reads a workflow from Redis using any redis command client (including a *redis.Tx).
+func LoadWorkflow(ctx context.Context, rdb redis.Cmdable, tenant, id string) (*Workflow, error) {
+	data, err := rdb.Get(ctx, WorkflowKey(tenant, id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrWorkflowNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var w Workflow
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, fmt.Errorf("decode workflow %s: %w", id, err)
+	}
+	return &w, nil
+}
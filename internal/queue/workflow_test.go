@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func step(id string, deps ...string) *Step {
+	return &Step{ID: id, DependsOn: deps}
+}
+
+// TestWorkflowValidate checks the duplicate-ID, unknown-dependency and cycle cases.
+func TestWorkflowValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []*Step
+		wantErr string
+	}{
+		{name: "single step", steps: []*Step{step("a")}},
+		{name: "diamond", steps: []*Step{step("a"), step("b", "a"), step("c", "a"), step("d", "b", "c")}},
+		{name: "no steps", wantErr: "no steps"},
+		{name: "missing id", steps: []*Step{step("")}, wantErr: "step id is required"},
+		{name: "duplicate id", steps: []*Step{step("a"), step("b"), step("a")}, wantErr: `duplicate step id "a"`},
+		{name: "unknown dependency", steps: []*Step{step("a", "missing")}, wantErr: `depends on unknown step "missing"`},
+		{name: "self dependency", steps: []*Step{step("a", "a")}, wantErr: "cycle"},
+		{name: "cycle", steps: []*Step{step("a", "c"), step("b", "a"), step("c", "b")}, wantErr: "cycle"},
+		{name: "cycle behind a root", steps: []*Step{step("root"), step("a", "root", "b"), step("b", "a")}, wantErr: "cycle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Workflow{Steps: tt.steps}).Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestWorkflowComplete runs a diamond workflow and checks which steps become
+// runnable or skipped, and the final workflow status.
+func TestWorkflowComplete(t *testing.T) {
+	tests := []struct {
+		name       string
+		fail       string
+		wantStatus map[string]string
+		wantWF     string
+	}{
+		{
+			name:       "all succeed",
+			wantStatus: map[string]string{"a": StepSucceeded, "b": StepSucceeded, "c": StepSucceeded, "d": StepSucceeded},
+			wantWF:     WorkflowSucceeded,
+		},
+		{
+			name:       "root fails",
+			fail:       "a",
+			wantStatus: map[string]string{"a": StepFailed, "b": StepSkipped, "c": StepSkipped, "d": StepSkipped},
+			wantWF:     WorkflowFailed,
+		},
+		{
+			name:       "branch fails",
+			fail:       "b",
+			wantStatus: map[string]string{"a": StepSucceeded, "b": StepFailed, "c": StepSucceeded, "d": StepSkipped},
+			wantWF:     WorkflowFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Workflow{Status: WorkflowRunning, Steps: []*Step{step("a"), step("b", "a"), step("c", "a"), step("d", "b", "c")}}
+			for _, s := range w.Steps {
+				s.Status = StepPending
+			}
+
+			// Run every runnable step until nothing is left, like the coordinator.
+			for runnable := w.Runnable(); len(runnable) > 0; runnable = w.Runnable() {
+				for _, s := range runnable {
+					s.Status = StepQueued
+				}
+				for _, s := range runnable {
+					var err error
+					if s.ID == tt.fail {
+						err = errors.New("boom")
+					}
+					if !w.Complete(s.ID, err) {
+						t.Fatalf("Complete(%q) = false", s.ID)
+					}
+				}
+			}
+
+			for id, want := range tt.wantStatus {
+				if got := w.Step(id).Status; got != want {
+					t.Errorf("step %q status = %q, want %q", id, got, want)
+				}
+			}
+			if w.Status != tt.wantWF {
+				t.Errorf("workflow status = %q, want %q", w.Status, tt.wantWF)
+			}
+			if w.Complete("a", nil) {
+				t.Error("Complete of an already finished step = true, want false")
+			}
+		})
+	}
+}
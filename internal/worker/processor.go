@@ -2,7 +2,6 @@ package worker
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -10,32 +9,51 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
+	"github.com/sanjeevsethi/sre-platform-app/internal/logger"
 	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+	"github.com/sanjeevsethi/sre-platform-app/internal/telemetry"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// log is the worker module logger; its level can be changed at runtime.
+var log = logger.Module(logger.ModuleWorker)
+
 // 1. Define Prometheus metrics for the worker
 var (
-	jobsProcessedTotal = promauto.NewCounter(
+	jobsProcessedTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "worker_service_jobs_processed_total",
 			Help: "Total number of jobs processed by the worker.",
 		},
+		[]string{"tenant"},
 	)
-	jobsFailedTotal = promauto.NewCounter(
+	jobsFailedTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "worker_service_jobs_failed_total",
 			Help: "Total number of jobs that failed processing.",
 		},
+		[]string{"tenant"},
 	)
 	queueDepth = promauto.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "worker_queue_depth",
-			Help: "Current depth of the jobs queue in Redis.",
+			Help: "Current depth of all jobs queues in Redis.",
+		},
+	)
+	jobsCancelledTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_service_jobs_cancelled_total",
+			Help: "Total number of dequeued jobs dropped because they were cancelled.",
+		},
+		[]string{"tenant"},
+	)
+	legacyJobsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "worker_legacy_jobs_total",
+			Help: "Total number of raw non-JSON queue entries accepted through the legacy fallback.",
 		},
 	)
 	jobDuration = promauto.NewHistogramVec(
@@ -44,7 +62,7 @@ var (
 			Help:    "Duration of job processing.",
 			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"status"},
+		[]string{"status", "tenant"},
 	)
 )
 
@@ -53,7 +71,7 @@ type Job = queue.Job
 
 const MaxRetries = 3
 
-func processJobWithRetry(l zerolog.Logger, job Job) (string, error) {
+func processJobWithRetry(ctx context.Context, l zerolog.Logger, job Job) (string, error) {
 	var err error
 	for i := 0; i <= MaxRetries; i++ {
 		if i > 0 {
@@ -83,7 +101,7 @@ func processJobWithRetry(l zerolog.Logger, job Job) (string, error) {
 		if err != nil {
 			status = "error"
 		} else {
-			jobDuration.WithLabelValues(status).Observe(duration)
+			telemetry.ObserveWithTrace(ctx, jobDuration.WithLabelValues(status, queue.TenantLabel(job.Tenant)), duration)
 			return status, nil // Success
 		}
 	}
@@ -91,9 +109,14 @@ func processJobWithRetry(l zerolog.Logger, job Job) (string, error) {
 }
 
 // Start begins the worker processing loop. It blocks until the context is done.
-func Start(ctx context.Context, rdb *redis.Client) {
+// The codec must match the producer's settings (a nil codec reads plain JSON jobs).
+func Start(ctx context.Context, rdb *redis.Client, codec *queue.Codec) {
 	log.Info().Msg("Starting worker process loop...")
 
+	coordinator := NewCoordinator(rdb, codec)
+	scheduler := newTenantScheduler(rdb)
+	go scheduler.run(ctx)
+
 	// Launch background monitor for queue depth
 	go func() {
 		ticker := time.NewTicker(5 * time.Second)
@@ -103,10 +126,7 @@ func Start(ctx context.Context, rdb *redis.Client) {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				val, err := rdb.LLen(ctx, "jobs").Result()
-				if err == nil {
-					queueDepth.Set(float64(val))
-				}
+				scheduler.observeDepths(ctx)
 			}
 		}
 	}()
@@ -120,9 +140,9 @@ func Start(ctx context.Context, rdb *redis.Client) {
 			// Continue
 		}
 
-		// 3. Block and wait for a new job on the 'jobs' queue
+		// 3. Block and wait for a new job on any tenant's queue
 		// BRPop blocks until a job is available or a timeout occurs
-		result, err := rdb.BRPop(ctx, 1*time.Second, "jobs").Result()
+		result, err := rdb.BRPop(ctx, 1*time.Second, scheduler.next()...).Result()
 		if err != nil {
 			if err == redis.Nil {
 				continue
@@ -131,17 +151,48 @@ func Start(ctx context.Context, rdb *redis.Client) {
 			continue
 		}
 
-		// result[1] is the job data (JSON string)
+		// result[0] is the queue it came from, result[1] the job data (JSON string)
+		scheduler.served(result[0])
 		rawJob := result[1]
 
-		var job Job
-		// Try parsing as JSON. If fails, assume legacy string format.
-		if err := json.Unmarshal([]byte(rawJob), &job); err != nil {
-			// Handle legacy string jobs or malformed JSON
-			job = Job{
-				ID:        "legacy",
-				Payload:   rawJob,
-				RequestID: "unknown",
+		// Decode and verify the job (plain JSON, legacy string or signed envelope).
+		// Anything the codec rejects is quarantined rather than processed.
+		job, err := codec.Decode([]byte(rawJob))
+		if err != nil {
+			log.Warn().Err(err).Str("reason", quarantineReason(err)).Msg("Rejected queue entry, moving to quarantine")
+			if qErr := quarantine(ctx, rdb, rawJob, err); qErr != nil {
+				log.Error().Err(qErr).Msg("Failed to quarantine queue entry")
+			}
+			continue
+		}
+		if job.ID == queue.LegacyJobID {
+			legacyJobsTotal.Inc()
+		}
+		// The queue a job was popped from decides its tenant, not the payload,
+		// so a crafted job cannot touch another tenant's keys.
+		tenant, ok := queue.TenantOfJobsKey(result[0])
+		if !ok {
+			log.Error().Str("queue", result[0]).Msg("Popped a job from an unknown queue, moving to quarantine")
+			if qErr := quarantine(ctx, rdb, rawJob, errUnknownQueue); qErr != nil {
+				log.Error().Err(qErr).Msg("Failed to quarantine queue entry")
+			}
+			continue
+		}
+		if queue.NormalizeTenant(job.Tenant) != tenant {
+			log.Warn().Str("job_id", job.ID).Str("claimed_tenant", job.Tenant).Str("tenant", tenant).Msg("Job claims another tenant than its queue, using the queue's")
+			job.Tenant = tenant
+		}
+
+		// Jobs cancelled while queued are dropped; workflow steps have no job status.
+		if job.WorkflowID == "" {
+			run, err := queue.StartJob(ctx, rdb, job)
+			if err != nil {
+				log.Warn().Err(err).Str("job_id", job.ID).Msg("Failed to mark job running")
+			}
+			if !run {
+				jobsCancelledTotal.WithLabelValues(queue.TenantLabel(job.Tenant)).Inc()
+				log.Info().Str("job_id", job.ID).Str("tenant", queue.NormalizeTenant(job.Tenant)).Msg("Skipping cancelled job")
+				continue
 			}
 		}
 
@@ -158,32 +209,46 @@ func Start(ctx context.Context, rdb *redis.Client) {
 
 		// Start span
 		tracer := otel.Tracer("worker-service")
-		_, span := tracer.Start(processCtx, "worker.process_job", trace.WithAttributes(
+		spanCtx, span := tracer.Start(processCtx, "worker.process_job", trace.WithAttributes(
 			attribute.String("job_id", job.ID),
 			attribute.String("request_id", job.RequestID),
+			attribute.String("tenant", queue.NormalizeTenant(job.Tenant)),
 			attribute.String("payload", job.Payload),
 		))
 
 		// Create a logger with context for this job, including trace info
-		l := log.With().
+		lc := log.With().
 			Str("job_id", job.ID).
 			Str("request_id", job.RequestID).
+			Str("tenant", queue.NormalizeTenant(job.Tenant)).
 			Str("trace_id", span.SpanContext().TraceID().String()).
-			Str("span_id", span.SpanContext().SpanID().String()).
-			Logger()
+			Str("span_id", span.SpanContext().SpanID().String())
+		if job.WorkflowID != "" {
+			lc = lc.Str("workflow_id", job.WorkflowID).Str("step_id", job.StepID)
+		}
+		l := lc.Logger()
 
 		l.Info().Str("payload", job.Payload).Msg("Processing job")
 
-		status, err := processJobWithRetry(l, job)
+		status, err := processJobWithRetry(spanCtx, l, job)
 
 		if err != nil {
-			jobsFailedTotal.Inc()
+			jobsFailedTotal.WithLabelValues(queue.TenantLabel(job.Tenant)).Inc()
 			l.Error().Err(err).Msg("Job failed after retries")
 			// Future: Push to Dead Letter Queue (DLQ)
 		} else {
-			jobsProcessedTotal.Inc()
+			jobsProcessedTotal.WithLabelValues(queue.TenantLabel(job.Tenant)).Inc()
 			l.Info().Str("status", status).Msg("Job processed successfully")
 		}
+
+		// Advance the owning workflow, if any, so dependent steps get enqueued.
+		if job.WorkflowID != "" {
+			if wfErr := coordinator.StepFinished(ctx, l, job, err); wfErr != nil {
+				l.Error().Err(wfErr).Msg("Failed to advance workflow")
+			}
+		} else if stErr := queue.FinishJob(ctx, rdb, job, err); stErr != nil {
+			l.Error().Err(stErr).Msg("Failed to record job status")
+		}
 		span.End()
 	}
 }
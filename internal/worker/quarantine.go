@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+)
+
+// QuarantineKey is the Redis list holding entries the worker refused to process.
+const QuarantineKey = "jobs:quarantine"
+
+// errUnknownQueue rejects an entry popped from a key that is no tenant's queue.
+var errUnknownQueue = errors.New("entry popped from an unknown queue")
+
+// maxQuarantineLen caps the quarantine list so a flood of forged entries cannot exhaust Redis memory.
+const maxQuarantineLen = 10000
+
+var jobsQuarantinedTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "worker_jobs_quarantined_total",
+		Help: "Total number of queue entries moved to quarantine instead of being processed.",
+	},
+	[]string{"reason"},
+)
+
+type quarantinedEntry struct {
+	Reason        string    `json:"reason"`
+	Error         string    `json:"error"`
+	Raw           string    `json:"raw"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// quarantineReason maps a decode error to a low-cardinality metric label.
+func quarantineReason(err error) string {
+	switch {
+	case errors.Is(err, queue.ErrUnsigned):
+		return "unsigned"
+	case errors.Is(err, queue.ErrBadSignature):
+		return "bad_signature"
+	case errors.Is(err, queue.ErrMalformed):
+		return "malformed"
+	case errors.Is(err, errUnknownQueue):
+		return "unknown_queue"
+	default:
+		return "decode_error"
+	}
+}
+
+// quarantine stores a rejected raw entry for later inspection.
+func quarantine(ctx context.Context, rdb *redis.Client, raw string, err error) error {
+	reason := quarantineReason(err)
+	jobsQuarantinedTotal.WithLabelValues(reason).Inc()
+
+	data, mErr := json.Marshal(quarantinedEntry{
+		Reason:        reason,
+		Error:         err.Error(),
+		Raw:           raw,
+		QuarantinedAt: time.Now().UTC(),
+	})
+	if mErr != nil {
+		return mErr
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.LPush(ctx, QuarantineKey, data)
+	pipe.LTrim(ctx, QuarantineKey, 0, maxQuarantineLen-1)
+	_, execErr := pipe.Exec(ctx)
+	return execErr
+}
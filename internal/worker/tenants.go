@@ -0,0 +1,125 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+)
+
+// tenantRefreshInterval is how often the worker picks up newly created tenant queues.
+const tenantRefreshInterval = 10 * time.Second
+
+var tenantQueueDepth = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "worker_tenant_queue_depth",
+		Help: "Current depth of each tenant's jobs queue in Redis.",
+	},
+	[]string{"tenant"},
+)
+
+// tenantScheduler spreads work fairly across tenant queues. BRPOP pops from
+// the first non-empty key in the order given, so starting the next BRPOP just
+// after the queue that was served last visits the non-empty queues round
+// robin: one busy tenant cannot starve the others.
+type tenantScheduler struct {
+	rdb *redis.Client
+
+	mu     sync.Mutex
+	keys   []string
+	offset int
+
+	// depthLabels are the tenant labels observeDepths last set.
+	depthLabels map[string]bool
+}
+
+func newTenantScheduler(rdb *redis.Client) *tenantScheduler {
+	return &tenantScheduler{rdb: rdb, keys: []string{queue.JobsKey}}
+}
+
+// run refreshes the tenant list until ctx is done.
+func (s *tenantScheduler) run(ctx context.Context) {
+	s.refresh(ctx)
+	ticker := time.NewTicker(tenantRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.refresh(ctx)
+		}
+	}
+}
+
+func (s *tenantScheduler) refresh(ctx context.Context) {
+	tenants, err := queue.Tenants(ctx, s.rdb)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to refresh tenant queues")
+		return
+	}
+	keys := make([]string, len(tenants))
+	for i, t := range tenants {
+		keys[i] = queue.TenantJobsKey(t)
+	}
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+}
+
+// next returns the queue keys to BRPOP from, in round-robin order.
+func (s *tenantScheduler) next() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offset := s.offset % len(s.keys)
+	out := make([]string, 0, len(s.keys))
+	out = append(out, s.keys[offset:]...)
+	return append(out, s.keys[:offset]...)
+}
+
+// served moves the round robin past the queue a job was just popped from.
+func (s *tenantScheduler) served(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, k := range s.keys {
+		if k == key {
+			s.offset = i + 1
+			return
+		}
+	}
+}
+
+// observeDepths records total and per-tenant queue depth.
+func (s *tenantScheduler) observeDepths(ctx context.Context) {
+	tenants, err := queue.Tenants(ctx, s.rdb)
+	if err != nil {
+		return
+	}
+	var total int64
+	byLabel := make(map[string]int64)
+	for _, t := range tenants {
+		depth, err := s.rdb.LLen(ctx, queue.TenantJobsKey(t)).Result()
+		if err != nil {
+			return
+		}
+		total += depth
+		byLabel[queue.TenantLabel(t)] += depth
+	}
+	queueDepth.Set(float64(total))
+	labels := make(map[string]bool, len(byLabel))
+	for label, depth := range byLabel {
+		tenantQueueDepth.WithLabelValues(label).Set(float64(depth))
+		labels[label] = true
+	}
+	// Drop the series of tenants that no longer have a queue.
+	for label := range s.depthLabels {
+		if !labels[label] {
+			tenantQueueDepth.DeleteLabelValues(label)
+		}
+	}
+	s.depthLabels = labels
+}
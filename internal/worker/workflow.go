@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+	"github.com/sanjeevsethi/sre-platform-app/internal/queue"
+)
+
+// maxWorkflowTxRetries bounds optimistic-lock retries when sibling steps finish concurrently.
+const maxWorkflowTxRetries = 10
+
+var (
+	workflowStepsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_workflow_steps_total",
+			Help: "Total number of workflow steps completed, by outcome.",
+		},
+		[]string{"status"},
+	)
+	workflowsCompletedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_workflows_completed_total",
+			Help: "Total number of workflows that reached a terminal state.",
+		},
+		[]string{"status"},
+	)
+)
+
+// Coordinator advances workflows as their steps finish: it records each step's
+// outcome and enqueues the steps that became runnable, atomically.
+type Coordinator struct {
+	rdb   *redis.Client
+	codec *queue.Codec
+}
+
+// NewCoordinator returns a Coordinator that enqueues follow-up steps with the given codec.
+func NewCoordinator(rdb *redis.Client, codec *queue.Codec) *Coordinator {
+	return &Coordinator{rdb: rdb, codec: codec}
+}
+
+// StepFinished records the result of a workflow step job and enqueues its successors.
+// The state update and the LPUSH of new jobs happen in one MULTI guarded by WATCH,
+// so two workers finishing the last steps of a parallel group cannot both (or
+// neither) trigger the fan-in callback.
+func (c *Coordinator) StepFinished(ctx context.Context, l zerolog.Logger, job Job, stepErr error) error {
+	key := queue.WorkflowKey(job.Tenant, job.WorkflowID)
+
+	var (
+		wf      *queue.Workflow
+		started []*queue.Step
+	)
+	txf := func(tx *redis.Tx) error {
+		var err error
+		wf, err = queue.LoadWorkflow(ctx, tx, job.Tenant, job.WorkflowID)
+		if err != nil {
+			return err
+		}
+		if !wf.Complete(job.StepID, stepErr) {
+			// Duplicate delivery or unknown step: nothing to do.
+			wf, started = nil, nil
+			return nil
+		}
+
+		started = wf.Runnable()
+		payloads := make([][]byte, 0, len(started))
+		for _, s := range started {
+			data, err := c.codec.Encode(queue.NewStepJob(ctx, wf, s))
+			if err != nil {
+				return err
+			}
+			payloads = append(payloads, data)
+		}
+
+		state, err := json.Marshal(wf)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, state, queue.WorkflowTTL)
+			for _, data := range payloads {
+				pipe.LPush(ctx, queue.TenantJobsKey(job.Tenant), data)
+			}
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < maxWorkflowTxRetries; i++ {
+		err = c.rdb.Watch(ctx, txf, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("advance workflow %s: %w", job.WorkflowID, err)
+	}
+	if wf == nil {
+		l.Warn().Str("workflow_id", job.WorkflowID).Str("step_id", job.StepID).Msg("Ignoring completion of step that is not queued")
+		return nil
+	}
+
+	status := queue.StepSucceeded
+	if stepErr != nil {
+		status = queue.StepFailed
+	}
+	workflowStepsTotal.WithLabelValues(status).Inc()
+
+	for _, s := range started {
+		l.Info().Str("workflow_id", wf.ID).Str("step_id", s.ID).Str("next_job_id", s.JobID).Msg("Enqueued workflow step")
+	}
+	if wf.Status != queue.WorkflowRunning {
+		workflowsCompletedTotal.WithLabelValues(wf.Status).Inc()
+		l.Info().Str("workflow_id", wf.ID).Str("status", wf.Status).Msg("Workflow finished")
+	}
+	return nil
+}
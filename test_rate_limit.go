@@ -9,7 +9,8 @@ import (
 
 func main() {
 	var wg sync.WaitGroup
-	url := "http://localhost:8080/healthz"
+	// /healthz, /ready and /metrics are exempt from rate limiting
+	url := "http://localhost:8080/version"
 	totalRequests := 200 // Default limit is 100 RPS, so this should trigger some 429s
 
 	fmt.Println("Starting rate limit test...")